@@ -0,0 +1,215 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+)
+
+// AddAttribute adds an attribute to an event
+func (client *Client) AddAttribute(eventID string, attr Attribute) (attribute Attribute, err error) {
+	return client.AddAttributeContext(context.Background(), eventID, attr)
+}
+
+// AddAttributeContext is like AddAttribute but honors ctx
+func (client *Client) AddAttributeContext(ctx context.Context, eventID string, attr Attribute) (attribute Attribute, err error) {
+	var (
+		path   string = "/attributes/add/" + eventID
+		result map[string]json.RawMessage
+	)
+
+	resp, err := client.PostContext(ctx, path, attr)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return attribute, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+	json.Unmarshal(result["Attribute"], &attribute)
+	return
+}
+
+// AttributeResult is the outcome of adding one attribute with AddAttributes
+type AttributeResult struct {
+	// Attribute is the attribute as saved by MISP, zero when Err is set
+	Attribute Attribute
+	Err       error
+}
+
+// AddAttributes adds several attributes to an event with a single request.
+// The returned slice has one result per attribute, in the same order. The
+// error is only set when the request itself failed.
+func (client *Client) AddAttributes(eventID string, attrs []Attribute) ([]AttributeResult, error) {
+	return client.AddAttributesContext(context.Background(), eventID, attrs)
+}
+
+// AddAttributesContext is like AddAttributes but honors ctx
+func (client *Client) AddAttributesContext(ctx context.Context, eventID string, attrs []Attribute) ([]AttributeResult, error) {
+	var result struct {
+		Attribute json.RawMessage `json:"Attribute"`
+		Errors    json.RawMessage `json:"errors"`
+	}
+
+	if len(attrs) == 0 {
+		return nil, nil
+	}
+
+	resp, err := client.PostContext(ctx, "/attributes/add/"+eventID, attrs)
+	if err != nil {
+		// MISP replies 403 when every attribute was rejected
+		if apiErr, ok := AsAPIError(err); ok && resp != nil && apiErr.StatusCode == http.StatusForbidden {
+			if json.Unmarshal(apiErr.Body, &result) == nil && len(result.Errors) > 0 {
+				return bulkResults(resp, attrs, nil, result.Errors), nil
+			}
+		}
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	// a single saved attribute comes back as an object
+	var saved []Attribute
+	if err = json.Unmarshal(result.Attribute, &saved); err != nil {
+		var one Attribute
+		if json.Unmarshal(result.Attribute, &one) == nil {
+			saved = []Attribute{one}
+		}
+	}
+	return bulkResults(resp, attrs, saved, result.Errors), nil
+}
+
+// bulkResults matches the attributes saved by MISP and the errors, keyed by
+// the index of the attribute in the request, with the attributes sent
+func bulkResults(resp *http.Response, attrs []Attribute, saved []Attribute, rawErrors json.RawMessage) []AttributeResult {
+	results := make([]AttributeResult, len(attrs))
+
+	var failures map[string]json.RawMessage
+	json.Unmarshal(rawErrors, &failures)
+	failed := make(map[int]bool, len(failures))
+	for key, raw := range failures {
+		i, err := strconv.Atoi(key)
+		if err != nil || i < 0 || i >= len(attrs) {
+			continue
+		}
+		apiErr := &APIError{
+			StatusCode: resp.StatusCode,
+			Message:    "Could not add Attribute",
+		}
+		if resp.Request != nil {
+			apiErr.Method = resp.Request.Method
+			apiErr.Path = resp.Request.URL.Path
+		}
+		apiErr.parseErrors("", raw)
+		results[i].Err = apiErr
+		failed[i] = true
+	}
+
+	// saved attributes keep the order of the request
+	next := 0
+	for i := range attrs {
+		if failed[i] {
+			continue
+		}
+		if next >= len(saved) {
+			results[i].Err = fmt.Errorf("AddAttributes(): MISP did not return attribute %d", i)
+			continue
+		}
+		results[i].Attribute = saved[next]
+		next++
+	}
+	return results
+}
+
+// Get an attribute by ID or UUID
+func (client *Client) GetAttribute(id string) (Attribute, error) {
+	return client.GetAttributeContext(context.Background(), id)
+}
+
+// GetAttributeContext is like GetAttribute but honors ctx
+func (client *Client) GetAttributeContext(ctx context.Context, id string) (Attribute, error) {
+	resp, err := client.GetContext(ctx, "/attributes/view/"+id, nil)
+	if err != nil {
+		return Attribute{}, err
+	}
+	return readAttribute(resp)
+}
+
+// UpdateAttribute edits an existing attribute, identified by its ID or else
+// its UUID. The timestamp is left for MISP to set, as it refuses edits which
+// are not newer than its own copy.
+func (client *Client) UpdateAttribute(attr Attribute) (Attribute, error) {
+	return client.UpdateAttributeContext(context.Background(), attr)
+}
+
+// UpdateAttributeContext is like UpdateAttribute but honors ctx
+func (client *Client) UpdateAttributeContext(ctx context.Context, attr Attribute) (Attribute, error) {
+	id := string(attr.ID)
+	if id == "" {
+		id = attr.UUID
+	}
+	if id == "" {
+		return Attribute{}, fmt.Errorf("UpdateAttribute(): attribute has no ID nor UUID")
+	}
+
+	data, err := ToMap(attr)
+	if err != nil {
+		return Attribute{}, err
+	}
+	delete(data, "timestamp")
+
+	resp, err := client.PostContext(ctx, "/attributes/edit/"+id, data)
+	if err != nil {
+		return Attribute{}, err
+	}
+	return readAttribute(resp)
+}
+
+// DeleteAttribute soft deletes an attribute, or removes it for good when hard
+// is set. Soft deleted attributes can be brought back with RestoreAttribute.
+func (client *Client) DeleteAttribute(id string, hard bool) (*Response, error) {
+	return client.DeleteAttributeContext(context.Background(), id, hard)
+}
+
+// DeleteAttributeContext is like DeleteAttribute but honors ctx
+func (client *Client) DeleteAttributeContext(ctx context.Context, id string, hard bool) (*Response, error) {
+	path := "/attributes/delete/" + id
+	if hard {
+		path += "/1"
+	}
+	return client.postResponse(ctx, path, nil)
+}
+
+// RestoreAttribute brings back a soft deleted attribute
+func (client *Client) RestoreAttribute(id string) (Attribute, error) {
+	return client.RestoreAttributeContext(context.Background(), id)
+}
+
+// RestoreAttributeContext is like RestoreAttribute but honors ctx
+func (client *Client) RestoreAttributeContext(ctx context.Context, id string) (Attribute, error) {
+	resp, err := client.PostContext(ctx, "/attributes/restore/"+id, nil)
+	if err != nil {
+		return Attribute{}, err
+	}
+	return readAttribute(resp)
+}
+
+// readAttribute decodes a {"Attribute": {...}} reply and closes its body
+func readAttribute(resp *http.Response) (attribute Attribute, err error) {
+	var result map[string]Attribute
+
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return attribute, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+	return result["Attribute"], nil
+}
@@ -0,0 +1,276 @@
+package misp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// ErrBatcherClosed is returned when adding to a closed SightingBatcher
+var ErrBatcherClosed = errors.New("sighting batcher closed")
+
+// SightingBatcher buffers sightings in memory and submits them with the
+// multi-value form of /sightings/add. The same value, type and source added
+// several times before a flush is sent once. A batch is flushed when it
+// reaches its maximum size or when the interval elapses, whichever comes
+// first. Batches failing for a transient reason are requeued and retried
+// with backoff; the ones MISP rejects are dropped, see LastError.
+//
+// The sightings are recorded by MISP at flush time unless their Timestamp or
+// DateSighting is set. It is safe for concurrent use.
+type SightingBatcher struct {
+	client   *Client
+	maxBatch int
+	interval time.Duration
+	backoff  RetryPolicy
+
+	mu      sync.Mutex
+	pending []Sighting
+	queued  map[batchKey]bool
+	// inFlight counts the sightings of the flush in progress
+	inFlight int
+	lastErr  error
+	closed   bool
+
+	full   chan struct{}
+	stop   chan struct{}
+	done   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// batchKey identifies the sightings deduplicated by the batcher
+type batchKey struct {
+	UUID      string
+	ID        FlexString
+	Value     string
+	Type      SightingType
+	Source    string
+	OrgID     FlexString
+	Timestamp int
+}
+
+// NewSightingBatcher returns a batcher sending through client batches of at
+// most maxBatch values, at least every interval, 500 values and a minute
+// when zero. Close must be called to send what is left and release it.
+func NewSightingBatcher(client *Client, maxBatch int, interval time.Duration) *SightingBatcher {
+	if maxBatch < 1 {
+		maxBatch = maxSightingValues
+	}
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	b := &SightingBatcher{
+		client:   client,
+		maxBatch: maxBatch,
+		interval: interval,
+		backoff:  DefaultRetryPolicy(),
+		queued:   make(map[batchKey]bool),
+		full:     make(chan struct{}, 1),
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	go b.run()
+	return b
+}
+
+// Add queues a sighting, by Value or by attribute UUID or ID. Values holds
+// more values to queue with the same type and source.
+func (b *SightingBatcher) Add(s Sighting) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.closed {
+		return ErrBatcherClosed
+	}
+	for _, one := range splitSighting(s) {
+		b.queue(one)
+	}
+	if len(b.pending) >= b.maxBatch {
+		select {
+		case b.full <- struct{}{}:
+		default:
+		}
+	}
+	return nil
+}
+
+// AddValue queues a sighting of value
+func (b *SightingBatcher) AddValue(value string, typ SightingType, source string) error {
+	return b.Add(Sighting{Value: value, Type: typ, Source: source})
+}
+
+// Pending returns the number of sightings not sent yet, including the ones
+// of a flush in progress which may still be requeued
+func (b *SightingBatcher) Pending() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending) + b.inFlight
+}
+
+// LastError returns the error of the last failed flush, nil when the last
+// flush succeeded
+func (b *SightingBatcher) LastError() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.lastErr
+}
+
+// Close stops the batcher and sends the pending sightings, retrying until
+// they are all sent or ctx is done. It returns an error when some could not
+// be sent.
+func (b *SightingBatcher) Close(ctx context.Context) error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return ErrBatcherClosed
+	}
+	b.closed = true
+	b.mu.Unlock()
+
+	close(b.stop)
+	select {
+	case <-b.done:
+	case <-ctx.Done():
+		// abort the flush in progress, its batch is requeued
+		b.cancel()
+		<-b.done
+	}
+	b.cancel()
+
+	for attempt := 1; !b.flush(ctx); attempt++ {
+		if err := sleep(ctx, b.backoff.backoff(attempt, nil), nil); err != nil {
+			break
+		}
+	}
+	if n := b.Pending(); n > 0 {
+		return fmt.Errorf("SightingBatcher: %d sightings not sent: %v", n, b.LastError())
+	}
+	return nil
+}
+
+// run flushes the batches until the batcher is stopped
+func (b *SightingBatcher) run() {
+	defer close(b.done)
+
+	failures := 0
+	for {
+		wait := b.interval
+		full := b.full
+		if failures > 0 {
+			// a full batch does not cut the backoff short
+			wait = b.backoff.backoff(failures, nil)
+			full = nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-b.stop:
+			timer.Stop()
+			return
+		case <-full:
+			timer.Stop()
+		case <-timer.C:
+		}
+
+		if b.flush(b.ctx) {
+			failures = 0
+		} else {
+			failures++
+		}
+	}
+}
+
+// flush sends the pending sightings. It returns false when some had to be
+// requeued.
+func (b *SightingBatcher) flush(ctx context.Context) bool {
+	b.mu.Lock()
+	sightings := b.pending
+	b.pending = nil
+	b.queued = make(map[batchKey]bool)
+	b.inFlight = len(sightings)
+	b.mu.Unlock()
+
+	var (
+		unsent  []Sighting
+		lastErr error
+	)
+	batches := coalesceSightings(sightings, b.maxBatch)
+	for i, batch := range batches {
+		_, err := b.client.AddSightingContext(ctx, &batch)
+		if err == nil {
+			continue
+		}
+		lastErr = err
+		if transientError(err) {
+			unsent = batches[i:]
+			break
+		}
+		// MISP would refuse this batch again, it is dropped
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.inFlight = 0
+	b.lastErr = lastErr
+	for _, batch := range unsent {
+		for _, one := range splitSighting(batch) {
+			b.queue(one)
+		}
+	}
+	return len(unsent) == 0
+}
+
+// queue adds s to the pending sightings unless already there, b.mu held
+func (b *SightingBatcher) queue(s Sighting) {
+	key := batchKey{
+		UUID:      s.UUID,
+		ID:        s.ID,
+		Value:     s.Value,
+		Type:      s.Type,
+		Source:    s.Source,
+		OrgID:     s.OrgID,
+		Timestamp: sightingTimestamp(&s),
+	}
+	if b.queued[key] {
+		return
+	}
+	b.queued[key] = true
+	b.pending = append(b.pending, s)
+}
+
+// splitSighting turns a sighting of several values into one sighting per
+// value
+func splitSighting(s Sighting) []Sighting {
+	if len(s.Values) == 0 {
+		return []Sighting{s}
+	}
+
+	var list []Sighting
+	values := s.Values
+	if s.Value != "" {
+		values = append([]string{s.Value}, values...)
+	}
+	s.Values = nil
+	for _, value := range values {
+		s.Value = value
+		list = append(list, s)
+	}
+	return list
+}
+
+// transientError tells whether a request failing with err is worth sending
+// again later
+func transientError(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	if !ok {
+		// transport error, timeout, cancelled flush...
+		return true
+	}
+	return apiErr.StatusCode == http.StatusTooManyRequests || apiErr.StatusCode >= 500
+}
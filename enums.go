@@ -0,0 +1,289 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// Distribution tells who an event, attribute or object is shared with
+type Distribution string
+
+const (
+	DistributionYourOrgOnly          Distribution = "0"
+	DistributionThisCommunityOnly    Distribution = "1"
+	DistributionConnectedCommunities Distribution = "2"
+	DistributionAllCommunities       Distribution = "3"
+	DistributionSharingGroup         Distribution = "4"
+	// DistributionInheritEvent only applies to attributes and objects
+	DistributionInheritEvent Distribution = "5"
+)
+
+// ThreatLevel is the threat level of an event
+type ThreatLevel string
+
+const (
+	ThreatLevelHigh      ThreatLevel = "1"
+	ThreatLevelMedium    ThreatLevel = "2"
+	ThreatLevelLow       ThreatLevel = "3"
+	ThreatLevelUndefined ThreatLevel = "4"
+)
+
+// Analysis is the maturity of the analysis of an event
+type Analysis string
+
+const (
+	AnalysisInitial   Analysis = "0"
+	AnalysisOngoing   Analysis = "1"
+	AnalysisCompleted Analysis = "2"
+)
+
+// SightingType tells what a sighting reports
+type SightingType string
+
+const (
+	SightingTypeSighting      SightingType = "0"
+	SightingTypeFalsePositive SightingType = "1"
+	SightingTypeExpiration    SightingType = "2"
+)
+
+// Category is the category of an attribute
+type Category string
+
+const (
+	CategoryInternalReference    Category = "Internal reference"
+	CategoryTargetingData        Category = "Targeting data"
+	CategoryAntivirusDetection   Category = "Antivirus detection"
+	CategoryPayloadDelivery      Category = "Payload delivery"
+	CategoryArtifactsDropped     Category = "Artifacts dropped"
+	CategoryPayloadInstallation  Category = "Payload installation"
+	CategoryPersistenceMechanism Category = "Persistence mechanism"
+	CategoryNetworkActivity      Category = "Network activity"
+	CategoryPayloadType          Category = "Payload type"
+	CategoryAttribution          Category = "Attribution"
+	CategoryExternalAnalysis     Category = "External analysis"
+	CategoryFinancialFraud       Category = "Financial fraud"
+	CategorySupportTool          Category = "Support Tool"
+	CategorySocialNetwork        Category = "Social network"
+	CategoryPerson               Category = "Person"
+	CategoryOther                Category = "Other"
+)
+
+// TypeMatrix lists the attribute types allowed in each category
+type TypeMatrix map[Category][]string
+
+// Allows reports whether attrType may be used in category
+func (m TypeMatrix) Allows(category Category, attrType string) bool {
+	types, ok := m[category]
+	return ok && contains(types, attrType)
+}
+
+// Validate returns an error when attrType may not be used in category
+func (m TypeMatrix) Validate(category Category, attrType string) error {
+	if _, ok := m[category]; !ok {
+		return fmt.Errorf("unknown category %q", category)
+	}
+	if !m.Allows(category, attrType) {
+		return fmt.Errorf("type %q is not allowed in category %q", attrType, category)
+	}
+	return nil
+}
+
+// Categories returns the categories in which attrType may be used
+func (m TypeMatrix) Categories(attrType string) []Category {
+	var categories []Category
+	for _, c := range allCategories {
+		if m.Allows(c, attrType) {
+			categories = append(categories, c)
+		}
+	}
+	return categories
+}
+
+// ValidateCategoryType checks attrType against category with
+// DefaultTypeMatrix
+func ValidateCategoryType(category Category, attrType string) error {
+	return DefaultTypeMatrix.Validate(category, attrType)
+}
+
+// Validate checks the attribute category and type with DefaultTypeMatrix
+func (a Attribute) Validate() error {
+	return ValidateCategoryType(a.Category, a.Type)
+}
+
+// DescribeTypes fetches the category/type matrix of the MISP instance, which
+// may know types newer than DefaultTypeMatrix
+func (client *Client) DescribeTypes() (TypeMatrix, error) {
+	return client.DescribeTypesContext(context.Background())
+}
+
+// DescribeTypesContext is like DescribeTypes but honors ctx
+func (client *Client) DescribeTypesContext(ctx context.Context) (TypeMatrix, error) {
+	var result struct {
+		Result struct {
+			CategoryTypeMappings TypeMatrix `json:"category_type_mappings"`
+		} `json:"result"`
+	}
+
+	res, err := client.GetContext(ctx, "/attributes/describeTypes.json", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if err = json.NewDecoder(res.Body).Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+	return result.Result.CategoryTypeMappings, nil
+}
+
+var allCategories = []Category{
+	CategoryInternalReference,
+	CategoryTargetingData,
+	CategoryAntivirusDetection,
+	CategoryPayloadDelivery,
+	CategoryArtifactsDropped,
+	CategoryPayloadInstallation,
+	CategoryPersistenceMechanism,
+	CategoryNetworkActivity,
+	CategoryPayloadType,
+	CategoryAttribution,
+	CategoryExternalAnalysis,
+	CategoryFinancialFraud,
+	CategorySupportTool,
+	CategorySocialNetwork,
+	CategoryPerson,
+	CategoryOther,
+}
+
+var (
+	hashTypes = []string{
+		"md5", "sha1", "sha224", "sha256", "sha384", "sha512", "sha512/224", "sha512/256",
+		"sha3-224", "sha3-256", "sha3-384", "sha3-512", "ssdeep", "imphash", "telfhash",
+		"impfuzzy", "authentihash", "vhash", "pehash", "tlsh", "cdhash",
+	}
+	filenameHashTypes = []string{
+		"filename", "filename|md5", "filename|sha1", "filename|sha224", "filename|sha256",
+		"filename|sha384", "filename|sha512", "filename|sha512/224", "filename|sha512/256",
+		"filename|sha3-224", "filename|sha3-256", "filename|sha3-384", "filename|sha3-512",
+		"filename|authentihash", "filename|vhash", "filename|ssdeep", "filename|tlsh",
+		"filename|imphash", "filename|impfuzzy", "filename|pehash",
+	}
+	x509Types = []string{
+		"x509-fingerprint-sha1", "x509-fingerprint-md5", "x509-fingerprint-sha256",
+	}
+	tlsFingerprintTypes = []string{
+		"ja3-fingerprint-md5", "jarm-fingerprint", "hassh-md5", "hasshserver-md5",
+	}
+)
+
+func concat(lists ...[]string) []string {
+	var all []string
+	for _, list := range lists {
+		all = append(all, list...)
+	}
+	return all
+}
+
+// DefaultTypeMatrix is the category/type matrix of MISP 2.4 (describeTypes)
+var DefaultTypeMatrix = TypeMatrix{
+	CategoryInternalReference: {
+		"text", "link", "comment", "other", "hex", "anonymised", "git-commit-id",
+	},
+	CategoryTargetingData: {
+		"target-user", "target-email", "target-machine", "target-org", "target-location",
+		"target-external", "comment", "anonymised",
+	},
+	CategoryAntivirusDetection: {
+		"link", "comment", "text", "hex", "attachment", "other", "anonymised",
+	},
+	CategoryPayloadDelivery: concat(hashTypes, filenameHashTypes, x509Types, tlsFingerprintTypes, []string{
+		"mac-address", "mac-eui-64", "ip-src", "ip-dst", "ip-dst|port", "ip-src|port",
+		"hostname", "domain", "email", "email-src", "email-dst", "email-subject",
+		"email-attachment", "email-body", "url", "user-agent", "AS", "pattern-in-file",
+		"pattern-in-traffic", "filename-pattern", "stix2-pattern", "yara", "sigma",
+		"mime-type", "attachment", "malware-sample", "link", "malware-type", "comment",
+		"text", "hex", "vulnerability", "cpe", "weakness", "other", "hostname|port",
+		"email-dst-display-name", "email-src-display-name", "email-header",
+		"email-reply-to", "email-x-mailer", "email-mime-boundary", "email-thread-index",
+		"email-message-id", "mobile-application-id", "chrome-extension-id",
+		"whois-registrant-email", "anonymised",
+	}),
+	CategoryArtifactsDropped: concat(hashTypes, filenameHashTypes, x509Types, []string{
+		"regkey", "regkey|value", "pattern-in-file", "pattern-in-memory",
+		"filename-pattern", "pdb", "stix2-pattern", "yara", "sigma", "attachment",
+		"malware-sample", "named pipe", "mutex", "process-state", "windows-scheduled-task",
+		"windows-service-name", "windows-service-displayname", "comment", "text", "hex",
+		"other", "cookie", "gene", "kusto-query", "mime-type", "anonymised",
+	}),
+	CategoryPayloadInstallation: concat(hashTypes, filenameHashTypes, x509Types, []string{
+		"pattern-in-file", "pattern-in-traffic", "pattern-in-memory", "filename-pattern",
+		"stix2-pattern", "yara", "sigma", "vulnerability", "cpe", "weakness", "attachment",
+		"malware-sample", "malware-type", "comment", "text", "hex",
+		"azure-application-id", "mobile-application-id", "chrome-extension-id", "other",
+		"mime-type", "anonymised",
+	}),
+	CategoryPersistenceMechanism: {
+		"filename", "regkey", "regkey|value", "comment", "text", "other", "hex", "anonymised",
+	},
+	CategoryNetworkActivity: concat(x509Types, tlsFingerprintTypes, []string{
+		"ip-src", "ip-dst", "ip-dst|port", "ip-src|port", "port", "hostname", "domain",
+		"domain|ip", "mac-address", "mac-eui-64", "email", "email-dst", "email-src",
+		"eppn", "url", "uri", "user-agent", "http-method", "AS", "snort",
+		"pattern-in-file", "filename-pattern", "stix2-pattern", "pattern-in-traffic",
+		"attachment", "comment", "text", "other", "hex", "cookie", "hostname|port",
+		"bro", "zeek", "anonymised", "community-id", "email-subject", "favicon-mmh3",
+		"dkim", "dkim-signature", "ssh-fingerprint",
+	}),
+	CategoryPayloadType: {
+		"comment", "text", "other", "anonymised",
+	},
+	CategoryAttribution: concat(x509Types, []string{
+		"threat-actor", "campaign-name", "campaign-id", "whois-registrant-phone",
+		"whois-registrant-email", "whois-registrant-name", "whois-registrant-org",
+		"whois-registrar", "whois-creation-date", "comment", "text", "other",
+		"dns-soa-email", "anonymised", "email",
+	}),
+	CategoryExternalAnalysis: concat(x509Types, tlsFingerprintTypes, []string{
+		"md5", "sha1", "sha256", "sha3-224", "sha3-256", "sha3-384", "sha3-512",
+		"filename", "filename|md5", "filename|sha1", "filename|sha256",
+		"filename|sha3-224", "filename|sha3-256", "filename|sha3-384",
+		"filename|sha3-512", "ip-src", "ip-dst", "ip-dst|port", "ip-src|port",
+		"mac-address", "mac-eui-64", "hostname", "domain", "domain|ip", "url",
+		"user-agent", "regkey", "regkey|value", "AS", "snort", "bro", "zeek",
+		"pattern-in-file", "pattern-in-traffic", "pattern-in-memory", "filename-pattern",
+		"vulnerability", "cpe", "weakness", "attachment", "malware-sample", "link",
+		"comment", "text", "github-repository", "other", "cortex", "anonymised",
+		"community-id",
+	}),
+	CategoryFinancialFraud: {
+		"btc", "dash", "xmr", "iban", "bic", "bank-account-nr", "aba-rtn", "bin",
+		"cc-number", "prtn", "phone-number", "comment", "text", "other", "hex",
+		"anonymised",
+	},
+	CategorySupportTool: {
+		"link", "text", "attachment", "comment", "other", "hex", "anonymised",
+	},
+	CategorySocialNetwork: {
+		"github-username", "github-repository", "github-organisation", "jabber-id",
+		"twitter-id", "email", "email-src", "email-dst", "eppn", "comment", "text",
+		"other", "whois-registrant-email", "anonymised", "pgp-public-key",
+		"pgp-private-key",
+	},
+	CategoryPerson: {
+		"first-name", "middle-name", "last-name", "full-name", "date-of-birth",
+		"place-of-birth", "gender", "passport-number", "passport-country",
+		"passport-expiration", "redress-number", "nationality", "visa-number",
+		"issue-date-of-the-visa", "primary-residence", "country-of-residence",
+		"special-service-request", "frequent-flyer-number", "travel-details",
+		"payment-details", "place-port-of-original-embarkation",
+		"place-port-of-clearance", "place-port-of-onward-foreign-destination",
+		"passenger-name-record-locator-number", "comment", "text", "other",
+		"phone-number", "identity-card-number", "anonymised", "email",
+		"pgp-public-key", "pgp-private-key",
+	},
+	CategoryOther: {
+		"comment", "text", "other", "size-in-bytes", "counter", "datetime", "cpe",
+		"port", "float", "hex", "phone-number", "boolean", "anonymised",
+		"pgp-public-key", "pgp-private-key",
+	},
+}
@@ -0,0 +1,160 @@
+package misp
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// APIError is returned when the MISP server replies with an unexpected status
+// code. It carries the JSON error document MISP sends along.
+type APIError struct {
+	StatusCode int
+	Method     string
+	Path       string
+	Name       string
+	Message    string
+	URL        string
+	// Errors holds the free form error messages
+	Errors []string
+	// ValidationErrors maps the offending field to its validation messages,
+	// nested models are flattened with a dot (e.g. "Attribute.value")
+	ValidationErrors map[string][]string
+	// Body is the raw response body, useful when it was not JSON
+	Body []byte
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("MISP server replied status=%d to %s %s", e.StatusCode, e.Method, e.Path)
+	if e.Message != "" {
+		msg += ": " + e.Message
+	} else if e.Name != "" {
+		msg += ": " + e.Name
+	}
+
+	details := e.Errors
+	fields := make([]string, 0, len(e.ValidationErrors))
+	for field := range e.ValidationErrors {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+	for _, field := range fields {
+		details = append(details, field+": "+strings.Join(e.ValidationErrors[field], ", "))
+	}
+	if len(details) > 0 {
+		msg += " (" + strings.Join(details, "; ") + ")"
+	}
+	return msg
+}
+
+type apiErrorBody struct {
+	Name    string          `json:"name"`
+	Message string          `json:"message"`
+	URL     string          `json:"url"`
+	Errors  json.RawMessage `json:"errors"`
+}
+
+// newAPIError builds an APIError out of a MISP error reply
+func newAPIError(resp *http.Response, body []byte) *APIError {
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Body:       body,
+	}
+	if resp.Request != nil {
+		apiErr.Method = resp.Request.Method
+		apiErr.Path = resp.Request.URL.Path
+	}
+
+	var b apiErrorBody
+	if err := json.Unmarshal(body, &b); err != nil {
+		return apiErr
+	}
+	apiErr.Name = b.Name
+	apiErr.Message = b.Message
+	apiErr.URL = b.URL
+	apiErr.parseErrors("", b.Errors)
+	return apiErr
+}
+
+// parseErrors decodes the "errors" member which MISP sends either as a
+// string, a list of strings or an object of fields
+func (e *APIError) parseErrors(field string, raw json.RawMessage) {
+	if len(raw) == 0 {
+		return
+	}
+
+	var (
+		str  string
+		list []json.RawMessage
+		obj  map[string]json.RawMessage
+	)
+	switch {
+	case json.Unmarshal(raw, &str) == nil:
+		if str == "" {
+			return
+		}
+		e.addError(field, str)
+	case json.Unmarshal(raw, &list) == nil:
+		for _, item := range list {
+			e.parseErrors(field, item)
+		}
+	case json.Unmarshal(raw, &obj) == nil:
+		for key, value := range obj {
+			if field != "" {
+				key = field + "." + key
+			}
+			e.parseErrors(key, value)
+		}
+	}
+}
+
+func (e *APIError) addError(field, msg string) {
+	if field == "" {
+		e.Errors = append(e.Errors, msg)
+		return
+	}
+	if e.ValidationErrors == nil {
+		e.ValidationErrors = make(map[string][]string)
+	}
+	e.ValidationErrors[field] = append(e.ValidationErrors[field], msg)
+}
+
+// AsAPIError returns the APIError wrapped in err, if any
+func AsAPIError(err error) (*APIError, bool) {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr, true
+	}
+	return nil, false
+}
+
+func hasStatus(err error, status int) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && apiErr.StatusCode == status
+}
+
+// IsNotFound reports whether MISP replied 404 Not Found
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsForbidden reports whether MISP replied 403 Forbidden
+func IsForbidden(err error) bool {
+	return hasStatus(err, http.StatusForbidden)
+}
+
+// IsUnauthorized reports whether MISP replied 401 Unauthorized, usually
+// because of a wrong API key
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
+
+// IsValidationError reports whether MISP rejected the data sent, listing
+// the offending fields
+func IsValidationError(err error) bool {
+	apiErr, ok := AsAPIError(err)
+	return ok && len(apiErr.ValidationErrors) > 0
+}
@@ -1,78 +1,83 @@
 package misp
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"net/http"
-	"strconv"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Event struct {
-	ID                 string `json:"id"`
-	OrgID              string `json:"org_id"`
-	Distribution       string `json:"distribution"`
-	Info               string `json:"info"`
-	OrgcID             string `json:"orgc_id"`
-	UUID               string `json:"uuid"`
-	Date               string `json:"date"`
-	Published          bool   `json:"published"`
-	Analysis           string `json:"analysis"`
-	AttributeCount     string `json:"attribute_count"`
-	Timestamp          string `json:"timestamp"`
-	SharingGroupID     string `json:"sharing_group_id"`
-	ProposalEmailLock  bool   `json:"proposal_email_lock"`
-	Locked             bool   `json:"locked"`
-	ThreatLevelID      string `json:"threat_level_id"`
-	PublishTimestamp   string `json:"publish_timestamp"`
-	SightingTimestamp  string `json:"sighting_timestamp"`
-	DisableCorrelation bool   `json:"disable_correlation"`
-	ExtendsUUID        string `json:"extends_uuid"`
-	EventCreatorEmail  string `json:"event_creator_email"`
-	Feed               Feed   `json:"Feed,omitempty"`
+	ID                 FlexString   `json:"id"`
+	OrgID              FlexString   `json:"org_id"`
+	Distribution       Distribution `json:"distribution"`
+	Info               string       `json:"info"`
+	OrgcID             FlexString   `json:"orgc_id"`
+	UUID               string       `json:"uuid"`
+	Date               MISPDate     `json:"date"`
+	Published          FlexBool     `json:"published"`
+	Analysis           Analysis     `json:"analysis"`
+	AttributeCount     FlexInt      `json:"attribute_count"`
+	Timestamp          UnixTime     `json:"timestamp"`
+	SharingGroupID     FlexString   `json:"sharing_group_id"`
+	ProposalEmailLock  FlexBool     `json:"proposal_email_lock"`
+	Locked             FlexBool     `json:"locked"`
+	ThreatLevelID      ThreatLevel  `json:"threat_level_id"`
+	PublishTimestamp   UnixTime     `json:"publish_timestamp"`
+	SightingTimestamp  UnixTime     `json:"sighting_timestamp"`
+	DisableCorrelation FlexBool     `json:"disable_correlation"`
+	ExtendsUUID        string       `json:"extends_uuid"`
+	EventCreatorEmail  string       `json:"event_creator_email"`
+	Feed               Feed         `json:"Feed,omitempty"`
 	Org                struct {
-		ID   string `json:"id"`
-		Name string `json:"name"`
-		UUID string `json:"uuid"`
+		ID   FlexString `json:"id"`
+		Name string     `json:"name"`
+		UUID string     `json:"uuid"`
 	} `json:"Org,omitempty"`
 	Orgc struct {
-		ID   string `json:"id"`
-		Name string `json:"name"`
-		UUID string `json:"uuid"`
+		ID   FlexString `json:"id"`
+		Name string     `json:"name"`
+		UUID string     `json:"uuid"`
 	} `json:"Orgc,omitempty"`
 	Attribute       []Attribute       `json:"Attribute,omitempty"`
 	ShadowAttribute []ShadowAttribute `json:"ShadowAttribute,omitempty"`
 	RelatedEvent    []interface{}     `json:"RelatedEvent,omitempty"`
 	Galaxy          []Galaxy          `json:"Galaxy,omitempty"`
 	Object          []Object          `json:"Object,omitempty"`
-	EventReport     []interface{}     `json:"EventReport,omitempty"`
+	EventReport     []EventReport     `json:"EventReport,omitempty"`
 	Tag             []Tag             `json:"Tag,omitempty"`
 }
 
 func NewEvent() Event {
 	now := time.Now()
-	y, m, d := now.Date()
 	return Event{
 		Published:        true,
 		UUID:             uuid.NewString(),
 		ExtendsUUID:      "",
-		Date:             fmt.Sprintf("%04d-%02d-%02d", y, m, d),
-		Timestamp:        strconv.FormatInt(now.Unix(), 10),
-		PublishTimestamp: strconv.FormatInt(now.Unix(), 10),
-		Analysis:         "2",
-		ThreatLevelID:    "4",
+		Date:             NewMISPDate(now),
+		Timestamp:        NewUnixTime(now),
+		PublishTimestamp: NewUnixTime(now),
+		Analysis:         AnalysisCompleted,
+		ThreatLevelID:    ThreatLevelUndefined,
 	}
 }
 
 // Get a list of events
 func (client *Client) GetEvents() (events []Event, err error) {
-	res, err := client.Get("/events", nil)
+	return client.GetEventsContext(context.Background())
+}
+
+// GetEventsContext is like GetEvents but honors ctx
+func (client *Client) GetEventsContext(ctx context.Context) (events []Event, err error) {
+	res, err := client.GetContext(ctx, "/events", nil)
 	if err != nil {
 		return
 	}
+	defer res.Body.Close()
 
 	d := json.NewDecoder(res.Body)
 	err = d.Decode(&events)
@@ -81,6 +86,11 @@ func (client *Client) GetEvents() (events []Event, err error) {
 
 // Get an event from a MISP instance
 func (client *Client) GetEvent(id string, deleted bool, extended bool) (event Event, err error) {
+	return client.GetEventContext(context.Background(), id, deleted, extended)
+}
+
+// GetEventContext is like GetEvent but honors ctx
+func (client *Client) GetEventContext(ctx context.Context, id string, deleted bool, extended bool) (event Event, err error) {
 	var (
 		res    *http.Response
 		result map[string]Event
@@ -95,13 +105,14 @@ func (client *Client) GetEvent(id string, deleted bool, extended bool) (event Ev
 	}
 
 	if len(data) > 0 {
-		res, err = client.Post("/events/view/"+id, data)
+		res, err = client.PostContext(RetrySafe(ctx), "/events/view/"+id, data)
 	} else {
-		res, err = client.Get("/events/view/"+id, nil)
+		res, err = client.GetContext(ctx, "/events/view/"+id, nil)
 	}
 	if err != nil {
 		return
 	}
+	defer res.Body.Close()
 
 	d := json.NewDecoder(res.Body)
 	err = d.Decode(&result)
@@ -111,7 +122,15 @@ func (client *Client) GetEvent(id string, deleted bool, extended bool) (event Ev
 
 // Check if event exists
 func (client *Client) EventExists(id string) (bool, error) {
-	if _, err := client.GetEvent(id, false, false); err != nil {
+	return client.EventExistsContext(context.Background(), id)
+}
+
+// EventExistsContext is like EventExists but honors ctx
+func (client *Client) EventExistsContext(ctx context.Context, id string) (bool, error) {
+	if _, err := client.GetEventContext(ctx, id, false, false); err != nil {
+		if IsNotFound(err) {
+			return false, nil
+		}
 		return false, err
 	}
 	return true, nil
@@ -119,9 +138,13 @@ func (client *Client) EventExists(id string) (bool, error) {
 
 // Add a new event on a MISP instance
 func (client *Client) AddEvent(event Event, metadata bool) (Event, error) {
+	return client.AddEventContext(context.Background(), event, metadata)
+}
+
+// AddEventContext is like AddEvent but honors ctx
+func (client *Client) AddEventContext(ctx context.Context, event Event, metadata bool) (Event, error) {
 	var (
 		path   string = "/events/add"
-		data   map[string]interface{}
 		result map[string]Event
 	)
 
@@ -129,19 +152,12 @@ func (client *Client) AddEvent(event Event, metadata bool) (Event, error) {
 		path = path + "/metadata:1"
 	}
 
-	// remove extra elements
-	data, _ = ToMap(event)
-	elem := []string{
-		"Feed",
-		"Org",
-		"Orgc",
-		"published",
-	}
-	for _, item := range elem {
-		delete(data, item)
+	data, err := eventData(event)
+	if err != nil {
+		return Event{}, err
 	}
 
-	res, err := client.Post(path, data)
+	res, err := client.PostContext(ctx, path, data)
 	if err != nil {
 		return Event{}, err
 	}
@@ -153,6 +169,11 @@ func (client *Client) AddEvent(event Event, metadata bool) (Event, error) {
 
 // Publish the event with one single HTTP POST
 func (client *Client) PublishEvent(eventID string, email bool) (*Response, error) {
+	return client.PublishEventContext(context.Background(), eventID, email)
+}
+
+// PublishEventContext is like PublishEvent but honors ctx
+func (client *Client) PublishEventContext(ctx context.Context, eventID string, email bool) (*Response, error) {
 	var path string
 	if email {
 		path = "/events/alert/%s"
@@ -161,8 +182,70 @@ func (client *Client) PublishEvent(eventID string, email bool) (*Response, error
 	}
 
 	path = fmt.Sprintf(path, eventID)
-	_, err := client.Post(path, nil)
-	return nil, err
+	return client.postResponse(ctx, path, nil)
+}
+
+// Unpublish the event
+func (client *Client) UnpublishEvent(eventID string) (*Response, error) {
+	return client.UnpublishEventContext(context.Background(), eventID)
+}
+
+// UnpublishEventContext is like UnpublishEvent but honors ctx
+func (client *Client) UnpublishEventContext(ctx context.Context, eventID string) (*Response, error) {
+	return client.postResponse(ctx, "/events/unpublish/"+eventID, nil)
+}
+
+// Update an existing event, identified by its ID or else its UUID. The
+// timestamps of the event, its attributes and objects are left for MISP to
+// set, as it refuses or skips what is not newer than its own copy.
+func (client *Client) UpdateEvent(event Event) (Event, error) {
+	return client.UpdateEventContext(context.Background(), event)
+}
+
+// UpdateEventContext is like UpdateEvent but honors ctx
+func (client *Client) UpdateEventContext(ctx context.Context, event Event) (Event, error) {
+	var result map[string]Event
+
+	id := string(event.ID)
+	if id == "" {
+		id = event.UUID
+	}
+	if id == "" {
+		return Event{}, fmt.Errorf("UpdateEvent(): event has no ID nor UUID")
+	}
+
+	data, err := eventData(event)
+	if err != nil {
+		return Event{}, err
+	}
+	delete(data, "timestamp")
+	dropAttributeTimestamps(data)
+	objects, _ := data["Object"].([]interface{})
+	for _, item := range objects {
+		if obj, ok := item.(map[string]interface{}); ok {
+			delete(obj, "timestamp")
+			dropAttributeTimestamps(obj)
+		}
+	}
+
+	res, err := client.PostContext(ctx, "/events/edit/"+id, data)
+	if err != nil {
+		return Event{}, err
+	}
+	defer res.Body.Close()
+	err = json.NewDecoder(res.Body).Decode(&result)
+	return result["Event"], err
+}
+
+// Delete an event. MISP deletes events for good, there is no way to restore
+// them afterwards.
+func (client *Client) DeleteEvent(eventID string) (*Response, error) {
+	return client.DeleteEventContext(context.Background(), eventID)
+}
+
+// DeleteEventContext is like DeleteEvent but honors ctx
+func (client *Client) DeleteEventContext(ctx context.Context, eventID string) (*Response, error) {
+	return client.postResponse(ctx, "/events/delete/"+eventID, nil)
 }
 
 func ReadEvent(body io.ReadCloser) (event Event, err error) {
@@ -172,3 +255,22 @@ func ReadEvent(body io.ReadCloser) (event Event, err error) {
 	err = decoder.Decode(&event)
 	return
 }
+
+// eventData turns event into the payload expected by /events/add and
+// /events/edit, without the elements MISP sets by itself
+func eventData(event Event) (map[string]interface{}, error) {
+	data, err := ToMap(event)
+	if err != nil {
+		return nil, err
+	}
+	elem := []string{
+		"Feed",
+		"Org",
+		"Orgc",
+		"published",
+	}
+	for _, item := range elem {
+		delete(data, item)
+	}
+	return data, nil
+}
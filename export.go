@@ -0,0 +1,136 @@
+package misp
+
+import (
+	"bufio"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ExportFormat is a restSearch returnFormat other than JSON
+type ExportFormat string
+
+const (
+	ExportCSV      ExportFormat = "csv"
+	ExportText     ExportFormat = "text"
+	ExportHashes   ExportFormat = "hashes"
+	ExportSuricata ExportFormat = "suricata"
+	ExportSnort    ExportFormat = "snort"
+	ExportBro      ExportFormat = "bro"
+	ExportZeek     ExportFormat = "zeek"
+	ExportYara     ExportFormat = "yara"
+	ExportRPZ      ExportFormat = "rpz"
+	ExportSTIX2    ExportFormat = "stix2"
+	ExportOpenIOC  ExportFormat = "openioc"
+	ExportCache    ExportFormat = "cache"
+)
+
+// accept returns the Accept header to send for the format. MISP only
+// authenticates API calls asking for JSON, XML or CSV, so the plain text
+// formats are requested as JSON and selected by returnFormat alone.
+func (f ExportFormat) accept() string {
+	switch f {
+	case ExportCSV:
+		return "text/csv"
+	case ExportOpenIOC:
+		return "application/xml"
+	}
+	return "application/json"
+}
+
+// Export runs a restSearch on controller ("events" or "attributes") with
+// the given returnFormat and copies the raw reply to w, without buffering it.
+// It returns the number of bytes written.
+func (client *Client) Export(ctx context.Context, controller string, format ExportFormat, search *Search, w io.Writer) (int64, error) {
+	s := copySearch(search)
+	s.ReturnFormat = string(format)
+
+	body, err := client.searchBody(ctx, controller, &s, format.accept())
+	if err != nil {
+		return 0, err
+	}
+	defer body.Close()
+	return io.Copy(w, body)
+}
+
+// ExportCSV runs an attribute restSearch in the CSV format and returns its
+// records keyed by the column names of the header line
+func (client *Client) ExportCSV(ctx context.Context, search *Search) ([]map[string]string, error) {
+	s := copySearch(search)
+	s.ReturnFormat = string(ExportCSV)
+
+	body, err := client.searchBody(ctx, "attributes", &s, ExportCSV.accept())
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ParseCSVExport(body)
+}
+
+// ParseCSVExport parses a MISP CSV export, whose first line holds the column
+// names
+func ParseCSVExport(r io.Reader) ([]map[string]string, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse CSV export: %s", err)
+	}
+
+	var records []map[string]string
+	for {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return records, nil
+		}
+		if err != nil {
+			return records, fmt.Errorf("Could not parse CSV export: %s", err)
+		}
+		record := make(map[string]string, len(header))
+		for i, column := range header {
+			if i < len(row) {
+				record[column] = row[i]
+			}
+		}
+		records = append(records, record)
+	}
+}
+
+// ExportHashes runs an attribute restSearch in the hashes format and returns
+// one hash per matching attribute
+func (client *Client) ExportHashes(ctx context.Context, search *Search) ([]string, error) {
+	s := copySearch(search)
+	s.ReturnFormat = string(ExportHashes)
+
+	body, err := client.searchBody(ctx, "attributes", &s, ExportHashes.accept())
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return ParseHashesExport(body)
+}
+
+// ParseHashesExport parses a MISP hashes export, one hash per line, skipping
+// blank and comment lines
+func ParseHashesExport(r io.Reader) ([]string, error) {
+	var hashes []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		hashes = append(hashes, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return hashes, fmt.Errorf("Could not parse hashes export: %s", err)
+	}
+	return hashes, nil
+}
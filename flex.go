@@ -0,0 +1,119 @@
+package misp
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// FlexString is a string MISP may also send as a number, a boolean or null
+type FlexString string
+
+func (s FlexString) String() string {
+	return string(s)
+}
+
+func (s *FlexString) UnmarshalJSON(data []byte) error {
+	str, err := unquoteScalar(data)
+	if err != nil {
+		var b bool
+		if json.Unmarshal(data, &b) != nil {
+			return fmt.Errorf("FlexString: %s", err)
+		}
+		str = strconv.FormatBool(b)
+	}
+	*s = FlexString(str)
+	return nil
+}
+
+// FlexInt is an integer MISP may also send as a string, a boolean or null
+type FlexInt int64
+
+func (i *FlexInt) UnmarshalJSON(data []byte) error {
+	var b bool
+	if json.Unmarshal(data, &b) == nil {
+		*i = 0
+		if b {
+			*i = 1
+		}
+		return nil
+	}
+
+	str, err := unquoteScalar(data)
+	if err != nil {
+		return fmt.Errorf("FlexInt: %s", err)
+	}
+	str = strings.TrimSpace(str)
+	if str == "" {
+		*i = 0
+		return nil
+	}
+	n, err := strconv.ParseInt(str, 10, 64)
+	if err != nil {
+		f, ferr := strconv.ParseFloat(str, 64)
+		if ferr != nil {
+			return fmt.Errorf("FlexInt: invalid integer %q", str)
+		}
+		n = int64(f)
+	}
+	*i = FlexInt(n)
+	return nil
+}
+
+// FlexBool is a boolean MISP may also send as "0"/"1", 0/1, "true"/"false"
+// or null
+type FlexBool bool
+
+func (b *FlexBool) UnmarshalJSON(data []byte) error {
+	var v bool
+	if json.Unmarshal(data, &v) == nil {
+		*b = FlexBool(v)
+		return nil
+	}
+
+	str, err := unquoteScalar(data)
+	if err != nil {
+		return fmt.Errorf("FlexBool: %s", err)
+	}
+	switch strings.ToLower(strings.TrimSpace(str)) {
+	case "", "0", "false", "no", "off":
+		*b = false
+	case "1", "true", "yes", "on":
+		*b = true
+	default:
+		n, err := strconv.ParseFloat(str, 64)
+		if err != nil {
+			return fmt.Errorf("FlexBool: invalid boolean %q", str)
+		}
+		*b = n != 0
+	}
+	return nil
+}
+
+// the enums are strings on the wire but some MISP versions send numbers
+
+func (d *Distribution) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*string)(d))
+}
+
+func (t *ThreatLevel) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*string)(t))
+}
+
+func (a *Analysis) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*string)(a))
+}
+
+func (t *SightingType) UnmarshalJSON(data []byte) error {
+	return unmarshalEnum(data, (*string)(t))
+}
+
+func unmarshalEnum(data []byte, s *string) error {
+	var fs FlexString
+	if err := fs.UnmarshalJSON(data); err != nil {
+		return err
+	}
+	*s = string(fs)
+	return nil
+}
@@ -0,0 +1,348 @@
+package misp
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// KillChainOrder maps kill chain names to their ordered phases. MISP sends
+// an empty array instead of an object for galaxies without kill chain.
+type KillChainOrder map[string][]string
+
+func (k *KillChainOrder) UnmarshalJSON(data []byte) error {
+	var order map[string][]string
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		var list []json.RawMessage
+		if err := json.Unmarshal(data, &list); err != nil || len(list) > 0 {
+			return fmt.Errorf("KillChainOrder: unexpected %s", data)
+		}
+	} else if err := json.Unmarshal(data, &order); err != nil {
+		return err
+	}
+	*k = order
+	return nil
+}
+
+// ClusterMeta holds the meta data of a galaxy cluster, such as synonyms,
+// refs, kill_chain or external_id. Single values are turned into lists.
+type ClusterMeta map[string][]string
+
+func (m *ClusterMeta) UnmarshalJSON(data []byte) error {
+	var raw map[string]json.RawMessage
+	if data = bytes.TrimSpace(data); len(data) > 0 && data[0] == '[' {
+		// no meta data comes back as an empty array
+		var list []json.RawMessage
+		if err := json.Unmarshal(data, &list); err != nil || len(list) > 0 {
+			return fmt.Errorf("ClusterMeta: unexpected %s", data)
+		}
+	} else if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	meta := make(ClusterMeta, len(raw))
+	for key, value := range raw {
+		var values []FlexString
+		if err := json.Unmarshal(value, &values); err != nil {
+			var one FlexString
+			if err = json.Unmarshal(value, &one); err != nil {
+				return fmt.Errorf("ClusterMeta: %s: %s", key, err)
+			}
+			values = []FlexString{one}
+		}
+		for _, v := range values {
+			meta[key] = append(meta[key], string(v))
+		}
+	}
+	*m = meta
+	return nil
+}
+
+// GalaxyCluster is a value of a galaxy, such as a threat actor or an ATT&CK
+// technique
+type GalaxyCluster struct {
+	ID             FlexString   `json:"id,omitempty"`
+	UUID           string       `json:"uuid"`
+	CollectionUUID string       `json:"collection_uuid,omitempty"`
+	Type           string       `json:"type"`
+	Value          string       `json:"value"`
+	TagName        string       `json:"tag_name,omitempty"`
+	Description    string       `json:"description"`
+	GalaxyID       FlexString   `json:"galaxy_id,omitempty"`
+	Source         string       `json:"source"`
+	Authors        []string     `json:"authors"`
+	Version        FlexString   `json:"version,omitempty"`
+	Distribution   Distribution `json:"distribution"`
+	SharingGroupID FlexString   `json:"sharing_group_id,omitempty"`
+	OrgID          FlexString   `json:"org_id,omitempty"`
+	OrgcID         FlexString   `json:"orgc_id,omitempty"`
+	Default        FlexBool     `json:"default,omitempty"`
+	Locked         FlexBool     `json:"locked,omitempty"`
+	ExtendsUUID    string       `json:"extends_uuid,omitempty"`
+	ExtendsVersion FlexString   `json:"extends_version,omitempty"`
+	Published      FlexBool     `json:"published,omitempty"`
+	Deleted        FlexBool     `json:"deleted,omitempty"`
+	// Meta is set on the clusters embedded in events and attributes
+	Meta ClusterMeta `json:"meta,omitempty"`
+	// Local tells whether the cluster is attached as a local tag
+	Local                    FlexBool                `json:"local,omitempty"`
+	Galaxy                   *Galaxy                 `json:"Galaxy,omitempty"`
+	GalaxyElement            []GalaxyElement         `json:"GalaxyElement,omitempty"`
+	GalaxyClusterRelation    []GalaxyClusterRelation `json:"GalaxyClusterRelation,omitempty"`
+	TargetingClusterRelation []GalaxyClusterRelation `json:"TargetingClusterRelation,omitempty"`
+}
+
+// MachineTag returns the misp-galaxy tag standing for the cluster
+func (c GalaxyCluster) MachineTag() MachineTag {
+	return MachineTag{Namespace: GalaxyNamespace, Predicate: c.Type, Value: c.Value}
+}
+
+// GalaxyElement is a key/value meta data of a galaxy cluster
+type GalaxyElement struct {
+	ID              FlexString `json:"id,omitempty"`
+	GalaxyClusterID FlexString `json:"galaxy_cluster_id,omitempty"`
+	Key             string     `json:"key"`
+	Value           string     `json:"value"`
+}
+
+// GalaxyClusterRelation links a galaxy cluster to another one
+type GalaxyClusterRelation struct {
+	ID                          FlexString   `json:"id,omitempty"`
+	GalaxyClusterID             FlexString   `json:"galaxy_cluster_id,omitempty"`
+	GalaxyClusterUUID           string       `json:"galaxy_cluster_uuid"`
+	ReferencedGalaxyClusterID   FlexString   `json:"referenced_galaxy_cluster_id,omitempty"`
+	ReferencedGalaxyClusterUUID string       `json:"referenced_galaxy_cluster_uuid"`
+	ReferencedGalaxyClusterType string       `json:"referenced_galaxy_cluster_type"`
+	Distribution                Distribution `json:"distribution"`
+	SharingGroupID              FlexString   `json:"sharing_group_id,omitempty"`
+	Default                     FlexBool     `json:"default,omitempty"`
+	Tag                         []Tag        `json:"Tag,omitempty"`
+}
+
+// List the galaxies of the MISP instance, without their clusters
+func (client *Client) ListGalaxies() ([]Galaxy, error) {
+	return client.ListGalaxiesContext(context.Background())
+}
+
+// ListGalaxiesContext is like ListGalaxies but honors ctx
+func (client *Client) ListGalaxiesContext(ctx context.Context) ([]Galaxy, error) {
+	var result []struct {
+		Galaxy Galaxy `json:"Galaxy"`
+	}
+
+	resp, err := client.GetContext(ctx, "/galaxies/index", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	galaxies := make([]Galaxy, 0, len(result))
+	for _, item := range result {
+		galaxies = append(galaxies, item.Galaxy)
+	}
+	return galaxies, nil
+}
+
+// Get a galaxy cluster by ID or UUID, with its elements and relations
+func (client *Client) GetGalaxyCluster(id string) (GalaxyCluster, error) {
+	return client.GetGalaxyClusterContext(context.Background(), id)
+}
+
+// GetGalaxyClusterContext is like GetGalaxyCluster but honors ctx
+func (client *Client) GetGalaxyClusterContext(ctx context.Context, id string) (GalaxyCluster, error) {
+	resp, err := client.GetContext(ctx, "/galaxy_clusters/view/"+id, nil)
+	if err != nil {
+		return GalaxyCluster{}, err
+	}
+	return readGalaxyCluster(resp)
+}
+
+// Galaxy cluster contexts of SearchGalaxyClusters
+const (
+	ClusterContextAll     = "all"
+	ClusterContextDefault = "default"
+	ClusterContextCustom  = "custom"
+	ClusterContextOrg     = "org"
+	ClusterContextDeleted = "deleted"
+)
+
+type clusterSearchRequest struct {
+	Context   string `json:"context,omitempty"`
+	SearchAll string `json:"searchall,omitempty"`
+}
+
+// SearchGalaxyClusters returns the clusters of a galaxy whose text fields
+// contain searchAll, every cluster when it is empty. clusterContext is one of
+// the ClusterContext constants, empty meaning all.
+func (client *Client) SearchGalaxyClusters(galaxyID string, clusterContext string, searchAll string) ([]GalaxyCluster, error) {
+	return client.SearchGalaxyClustersContext(context.Background(), galaxyID, clusterContext, searchAll)
+}
+
+// SearchGalaxyClustersContext is like SearchGalaxyClusters but honors ctx
+func (client *Client) SearchGalaxyClustersContext(ctx context.Context, galaxyID string, clusterContext string, searchAll string) ([]GalaxyCluster, error) {
+	var result []struct {
+		GalaxyCluster GalaxyCluster `json:"GalaxyCluster"`
+	}
+
+	req := clusterSearchRequest{Context: clusterContext, SearchAll: searchAll}
+	// the index does not modify anything, it can be replayed
+	resp, err := client.PostContext(RetrySafe(ctx), "/galaxy_clusters/index/"+galaxyID, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	clusters := make([]GalaxyCluster, 0, len(result))
+	for _, item := range result {
+		clusters = append(clusters, item.GalaxyCluster)
+	}
+	return clusters, nil
+}
+
+// Targets of AttachCluster
+const (
+	ClusterTargetEvent     = "event"
+	ClusterTargetAttribute = "attribute"
+)
+
+type attachClusterRequest struct {
+	Galaxy struct {
+		TargetID string `json:"target_id"`
+	} `json:"Galaxy"`
+}
+
+// AttachCluster attaches the galaxy cluster clusterID to the event or
+// attribute targetID, targetType being ClusterTargetEvent or
+// ClusterTargetAttribute. A local cluster is not synchronised to other
+// instances.
+func (client *Client) AttachCluster(targetType string, targetID string, clusterID string, local bool) (*Response, error) {
+	return client.AttachClusterContext(context.Background(), targetType, targetID, clusterID, local)
+}
+
+// AttachClusterContext is like AttachCluster but honors ctx
+func (client *Client) AttachClusterContext(ctx context.Context, targetType string, targetID string, clusterID string, local bool) (*Response, error) {
+	var req attachClusterRequest
+	req.Galaxy.TargetID = clusterID
+
+	l := 0
+	if local {
+		l = 1
+	}
+	path := fmt.Sprintf("/galaxies/attachCluster/%s/%s/local:%d", targetID, targetType, l)
+	return client.postResponse(ctx, path, req)
+}
+
+// AddGalaxyCluster adds a custom cluster to a galaxy
+func (client *Client) AddGalaxyCluster(galaxyID string, cluster GalaxyCluster) (GalaxyCluster, error) {
+	return client.AddGalaxyClusterContext(context.Background(), galaxyID, cluster)
+}
+
+// AddGalaxyClusterContext is like AddGalaxyCluster but honors ctx
+func (client *Client) AddGalaxyClusterContext(ctx context.Context, galaxyID string, cluster GalaxyCluster) (GalaxyCluster, error) {
+	data, err := clusterData(cluster)
+	if err != nil {
+		return GalaxyCluster{}, err
+	}
+
+	resp, err := client.PostContext(ctx, "/galaxy_clusters/add/"+galaxyID, data)
+	if err != nil {
+		return GalaxyCluster{}, err
+	}
+	return readGalaxyCluster(resp)
+}
+
+// UpdateGalaxyCluster edits a custom cluster, identified by its ID or else its
+// UUID. Default clusters cannot be edited.
+func (client *Client) UpdateGalaxyCluster(cluster GalaxyCluster) (GalaxyCluster, error) {
+	return client.UpdateGalaxyClusterContext(context.Background(), cluster)
+}
+
+// UpdateGalaxyClusterContext is like UpdateGalaxyCluster but honors ctx
+func (client *Client) UpdateGalaxyClusterContext(ctx context.Context, cluster GalaxyCluster) (GalaxyCluster, error) {
+	id := string(cluster.ID)
+	if id == "" {
+		id = cluster.UUID
+	}
+	if id == "" {
+		return GalaxyCluster{}, fmt.Errorf("UpdateGalaxyCluster(): cluster has no ID nor UUID")
+	}
+
+	data, err := clusterData(cluster)
+	if err != nil {
+		return GalaxyCluster{}, err
+	}
+
+	resp, err := client.PostContext(ctx, "/galaxy_clusters/edit/"+id, data)
+	if err != nil {
+		return GalaxyCluster{}, err
+	}
+	return readGalaxyCluster(resp)
+}
+
+// DeleteGalaxyCluster soft deletes a custom cluster, or removes it for good
+// when hard is set
+func (client *Client) DeleteGalaxyCluster(id string, hard bool) (*Response, error) {
+	return client.DeleteGalaxyClusterContext(context.Background(), id, hard)
+}
+
+// DeleteGalaxyClusterContext is like DeleteGalaxyCluster but honors ctx
+func (client *Client) DeleteGalaxyClusterContext(ctx context.Context, id string, hard bool) (*Response, error) {
+	path := "/galaxy_clusters/delete/" + id
+	if hard {
+		path += "/1"
+	}
+	return client.postResponse(ctx, path, nil)
+}
+
+// clusterData turns cluster into the payload expected by /galaxy_clusters/add
+// and /galaxy_clusters/edit, without the elements MISP sets by itself
+func clusterData(cluster GalaxyCluster) (map[string]interface{}, error) {
+	data, err := ToMap(cluster)
+	if err != nil {
+		return nil, err
+	}
+	elem := []string{
+		"id",
+		"galaxy_id",
+		"tag_name",
+		"org_id",
+		"orgc_id",
+		"default",
+		"locked",
+		"published",
+		"deleted",
+		"meta",
+		"local",
+		"Galaxy",
+		"TargetingClusterRelation",
+	}
+	for _, item := range elem {
+		delete(data, item)
+	}
+	return map[string]interface{}{"GalaxyCluster": data}, nil
+}
+
+// readGalaxyCluster decodes a {"GalaxyCluster": {...}} reply and closes its
+// body
+func readGalaxyCluster(resp *http.Response) (cluster GalaxyCluster, err error) {
+	var result map[string]GalaxyCluster
+
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return cluster, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+	return result["GalaxyCluster"], nil
+}
@@ -0,0 +1,210 @@
+package misp
+
+import (
+	"context"
+)
+
+// DefaultPageSize is the page size used by the iterators when the search
+// does not set a limit
+const DefaultPageSize = 500
+
+// pager walks the pages of a search until an empty one
+type pager struct {
+	ctx  context.Context
+	page int
+	err  error
+	done bool
+}
+
+func newPager(ctx context.Context, page int) pager {
+	if page < 1 {
+		page = 1
+	}
+	return pager{ctx: ctx, page: page}
+}
+
+// alive reports whether the iteration may go on, recording the context
+// error when it was cancelled
+func (p *pager) alive() bool {
+	if p.err == nil {
+		p.err = p.ctx.Err()
+	}
+	return p.err == nil
+}
+
+// next fetches the next page with fetch, which returns the number of items
+// it got. It returns false once the iteration is over.
+func (p *pager) next(fetch func(ctx context.Context, page int) (int, error)) bool {
+	if p.done || !p.alive() {
+		return false
+	}
+
+	n, err := fetch(p.ctx, p.page)
+	if err != nil {
+		p.err = err
+		return false
+	}
+	p.page++
+	if n == 0 {
+		p.done = true
+		return false
+	}
+	return true
+}
+
+// EventIterator iterates over the events matching a search, one page at a
+// time:
+//
+//	it := client.IterateEvents(ctx, &misp.Search{Tags: []string{"tlp:white"}})
+//	for it.Next() {
+//		event := it.Value()
+//	}
+//	if err := it.Err(); err != nil {
+//		...
+//	}
+type EventIterator struct {
+	pager
+	fetch func(ctx context.Context, page int) ([]Event, error)
+	buf   []Event
+	cur   Event
+}
+
+// Next advances to the next event, fetching a new page when needed. It
+// returns false when there are no more events or on error.
+func (it *EventIterator) Next() bool {
+	if !it.alive() {
+		return false
+	}
+	for len(it.buf) == 0 {
+		more := it.pager.next(func(ctx context.Context, page int) (int, error) {
+			events, err := it.fetch(ctx, page)
+			it.buf = events
+			return len(events), err
+		})
+		if !more {
+			return false
+		}
+	}
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// Value returns the current event
+func (it *EventIterator) Value() Event {
+	return it.cur
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *EventIterator) Err() error {
+	return it.err
+}
+
+// AttributeIterator iterates over the attributes matching a search, one page
+// at a time
+type AttributeIterator struct {
+	pager
+	fetch func(ctx context.Context, page int) ([]Attribute, error)
+	buf   []Attribute
+	cur   Attribute
+}
+
+// Next advances to the next attribute, fetching a new page when needed. It
+// returns false when there are no more attributes or on error.
+func (it *AttributeIterator) Next() bool {
+	if !it.alive() {
+		return false
+	}
+	for len(it.buf) == 0 {
+		more := it.pager.next(func(ctx context.Context, page int) (int, error) {
+			attributes, err := it.fetch(ctx, page)
+			it.buf = attributes
+			return len(attributes), err
+		})
+		if !more {
+			return false
+		}
+	}
+	it.cur, it.buf = it.buf[0], it.buf[1:]
+	return true
+}
+
+// Value returns the current attribute
+func (it *AttributeIterator) Value() Attribute {
+	return it.cur
+}
+
+// Err returns the error which stopped the iteration, if any
+func (it *AttributeIterator) Err() error {
+	return it.err
+}
+
+// IterateEvents returns an iterator over the events matching search, through
+// /events/restSearch. search.Page is the first page fetched and search.Limit
+// the page size, DefaultPageSize when unset. search is not modified.
+func (client *Client) IterateEvents(ctx context.Context, search *Search) *EventIterator {
+	s := copySearch(search)
+	if s.Limit == 0 {
+		s.Limit = DefaultPageSize
+	}
+	return &EventIterator{
+		pager: newPager(ctx, s.Page),
+		fetch: func(ctx context.Context, page int) ([]Event, error) {
+			s.Page = page
+			result, err := client.SearchEventsContext(ctx, &s)
+			if err != nil {
+				return nil, err
+			}
+			events := make([]Event, 0, len(result.Response))
+			for _, item := range result.Response {
+				events = append(events, item["Event"])
+			}
+			return events, nil
+		},
+	}
+}
+
+// IterateIndex returns an iterator over the event index, see IterateEvents
+func (client *Client) IterateIndex(ctx context.Context, search *IndexSearch) *EventIterator {
+	var s IndexSearch
+	if search != nil {
+		s = *search
+	}
+	if s.Limit == 0 {
+		s.Limit = DefaultPageSize
+	}
+	return &EventIterator{
+		pager: newPager(ctx, s.Page),
+		fetch: func(ctx context.Context, page int) ([]Event, error) {
+			s.Page = page
+			return client.SearchIndexContext(ctx, &s)
+		},
+	}
+}
+
+// IterateAttributes returns an iterator over the attributes matching search,
+// through /attributes/restSearch, see IterateEvents
+func (client *Client) IterateAttributes(ctx context.Context, search *Search) *AttributeIterator {
+	s := copySearch(search)
+	if s.Limit == 0 {
+		s.Limit = DefaultPageSize
+	}
+	return &AttributeIterator{
+		pager: newPager(ctx, s.Page),
+		fetch: func(ctx context.Context, page int) ([]Attribute, error) {
+			s.Page = page
+			result, err := client.SearchAttributesContext(ctx, &s)
+			if err != nil {
+				return nil, err
+			}
+			return result.Response["Attribute"], nil
+		},
+	}
+}
+
+// copySearch returns a copy of search, a nil search being an empty one
+func copySearch(search *Search) Search {
+	if search == nil {
+		return Search{}
+	}
+	return *search
+}
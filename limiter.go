@@ -0,0 +1,190 @@
+package misp
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Limiter throttles the requests sent to a MISP instance with a token bucket
+// and caps how many of them are in flight at once. A Limiter can be shared by
+// several Clients and its limits changed at any time.
+type Limiter struct {
+	mu          sync.Mutex
+	rate        float64 // tokens per second, 0 means unlimited
+	burst       int
+	tokens      float64
+	last        time.Time
+	maxInFlight int // 0 means unlimited
+	inFlight    int
+	// wake is closed, and replaced, whenever a waiter may proceed
+	wake chan struct{}
+}
+
+// NewLimiter allows ratePerSecond requests per second with bursts of up to
+// burst requests, and at most maxInFlight concurrent requests. A zero value
+// disables the corresponding limit.
+func NewLimiter(ratePerSecond float64, burst int, maxInFlight int) *Limiter {
+	l := &Limiter{}
+	l.SetRate(ratePerSecond, burst)
+	l.SetMaxInFlight(maxInFlight)
+	return l
+}
+
+// SetRate changes the rate and burst of the token bucket
+func (l *Limiter) SetRate(ratePerSecond float64, burst int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	fresh := l.last.IsZero()
+	l.refill(time.Now())
+	if burst < 1 {
+		burst = 1
+	}
+	l.rate = ratePerSecond
+	l.burst = burst
+	if fresh || l.tokens > float64(burst) {
+		l.tokens = float64(burst)
+	}
+	l.broadcast()
+}
+
+// SetMaxInFlight changes the maximum number of concurrent requests
+func (l *Limiter) SetMaxInFlight(n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.maxInFlight = n
+	l.broadcast()
+}
+
+// Limits returns the current rate, burst and maximum of concurrent requests
+func (l *Limiter) Limits() (ratePerSecond float64, burst int, maxInFlight int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate, l.burst, l.maxInFlight
+}
+
+// InFlight returns the number of requests currently holding a slot
+func (l *Limiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// Acquire waits until a request may be sent or ctx is done. The returned
+// function must be called once the request is over.
+func (l *Limiter) Acquire(ctx context.Context) (release func(), err error) {
+	for {
+		l.mu.Lock()
+		if l.wake == nil {
+			l.wake = make(chan struct{})
+		}
+		wake := l.wake
+
+		var wait time.Duration
+		if l.maxInFlight > 0 && l.inFlight >= l.maxInFlight {
+			wait = -1
+		} else if l.rate > 0 {
+			l.refill(time.Now())
+			if l.tokens < 1 {
+				wait = time.Duration((1 - l.tokens) / l.rate * float64(time.Second))
+			}
+		}
+
+		if wait == 0 {
+			if l.rate > 0 {
+				l.tokens--
+			}
+			l.inFlight++
+			l.mu.Unlock()
+
+			var once sync.Once
+			return func() { once.Do(l.release) }, nil
+		}
+		l.mu.Unlock()
+
+		if err := sleep(ctx, wait, wake); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// sleep waits for wait, a wake up or ctx, whichever comes first. A negative
+// wait only ends on wake up or ctx.
+func sleep(ctx context.Context, wait time.Duration, wake <-chan struct{}) error {
+	var timeout <-chan time.Time
+	if wait >= 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-wake:
+	case <-timeout:
+	}
+	return nil
+}
+
+func (l *Limiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.inFlight--
+	l.broadcast()
+}
+
+// refill adds the tokens earned since the last refill, l.mu must be held
+func (l *Limiter) refill(now time.Time) {
+	if !l.last.IsZero() && l.rate > 0 {
+		l.tokens += now.Sub(l.last).Seconds() * l.rate
+		if l.tokens > float64(l.burst) {
+			l.tokens = float64(l.burst)
+		}
+	}
+	l.last = now
+}
+
+// broadcast wakes up every waiter, l.mu must be held
+func (l *Limiter) broadcast() {
+	if l.wake != nil {
+		close(l.wake)
+	}
+	l.wake = make(chan struct{})
+}
+
+// releaseBody gives the limiter slot back when the body is closed
+type releaseBody struct {
+	io.ReadCloser
+	release func()
+}
+
+func (b *releaseBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.release()
+	return err
+}
+
+// roundTrip sends httpReq through the client limiter. The slot is held until
+// the response body is closed.
+func (client *Client) roundTrip(httpReq *http.Request) (*http.Response, error) {
+	if client.Limiter == nil {
+		return client.httpClient().Do(httpReq)
+	}
+
+	release, err := client.Limiter.Acquire(httpReq.Context())
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.httpClient().Do(httpReq)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	resp.Body = &releaseBody{ReadCloser: resp.Body, release: release}
+	return resp, nil
+}
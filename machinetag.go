@@ -0,0 +1,129 @@
+package misp
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GalaxyNamespace is the namespace of the tags standing for galaxy clusters
+const GalaxyNamespace = "misp-galaxy"
+
+// MachineTag is a taxonomy triple such as tlp:amber or
+// admiralty-scale:source-reliability="b"
+type MachineTag struct {
+	Namespace string
+	Predicate string
+	// Value is empty for the namespace:predicate form
+	Value string
+}
+
+// ParseMachineTag parses a tag name of the form namespace:predicate or
+// namespace:predicate="value"
+func ParseMachineTag(name string) (MachineTag, error) {
+	var tag MachineTag
+
+	i := strings.Index(name, ":")
+	if i <= 0 {
+		return tag, fmt.Errorf("ParseMachineTag(): %q has no namespace", name)
+	}
+	tag.Namespace, name = name[:i], name[i+1:]
+
+	if i = strings.Index(name, "="); i >= 0 {
+		tag.Predicate, name = name[:i], name[i+1:]
+		// the value may hold quotes, only the outer ones delimit it
+		if len(name) < 2 || name[0] != '"' || name[len(name)-1] != '"' {
+			return tag, fmt.Errorf("ParseMachineTag(): value %s is not quoted", name)
+		}
+		tag.Value = name[1 : len(name)-1]
+		if tag.Value == "" {
+			return tag, fmt.Errorf("ParseMachineTag(): empty value")
+		}
+	} else {
+		tag.Predicate = name
+	}
+
+	if tag.Predicate == "" {
+		return tag, fmt.Errorf("ParseMachineTag(): empty predicate")
+	}
+	return tag, nil
+}
+
+// String renders the tag name as MISP stores it
+func (t MachineTag) String() string {
+	if t.Value == "" {
+		return t.Namespace + ":" + t.Predicate
+	}
+	return fmt.Sprintf("%s:%s=\"%s\"", t.Namespace, t.Predicate, t.Value)
+}
+
+// IsGalaxy reports whether the tag stands for a galaxy cluster, the galaxy
+// type being the predicate and the cluster the value
+func (t MachineTag) IsGalaxy() bool {
+	return t.Namespace == GalaxyNamespace
+}
+
+// MachineTag parses the name of the tag, see ParseMachineTag
+func (t Tag) MachineTag() (MachineTag, error) {
+	return ParseMachineTag(t.Name)
+}
+
+// TLP is a Traffic Light Protocol level
+type TLP string
+
+const (
+	TLPClear       TLP = "clear"
+	TLPWhite       TLP = "white"
+	TLPGreen       TLP = "green"
+	TLPAmber       TLP = "amber"
+	TLPAmberStrict TLP = "amber+strict"
+	TLPRed         TLP = "red"
+)
+
+// tlpLevels ranks the TLP levels from the least to the most restrictive,
+// TLP 2.0 clear being the former white
+var tlpLevels = map[TLP]int{
+	TLPClear:       0,
+	TLPWhite:       0,
+	TLPGreen:       1,
+	TLPAmber:       2,
+	TLPAmberStrict: 3,
+	TLPRed:         4,
+}
+
+// Tag returns the tlp tag of the level
+func (l TLP) Tag() MachineTag {
+	return MachineTag{Namespace: "tlp", Predicate: string(l)}
+}
+
+// MoreRestrictive reports whether l shares less than other
+func (l TLP) MoreRestrictive(other TLP) bool {
+	return tlpLevels[l] > tlpLevels[other]
+}
+
+// TLPFromTags returns the effective TLP of tags, the most restrictive one
+// when several are set. It returns false when no tag is a known TLP level.
+func TLPFromTags(tags []Tag) (TLP, bool) {
+	var (
+		level TLP
+		found bool
+	)
+	for _, tag := range tags {
+		mt, err := tag.MachineTag()
+		if err != nil || !strings.EqualFold(mt.Namespace, "tlp") || mt.Value != "" {
+			continue
+		}
+		l := TLP(strings.ToLower(mt.Predicate))
+		if _, ok := tlpLevels[l]; !ok {
+			continue
+		}
+		if !found || l.MoreRestrictive(level) {
+			level, found = l, true
+		}
+	}
+	return level, found
+}
+
+// TLP returns the effective TLP of the event, see TLPFromTags
+func (event Event) TLP() (TLP, bool) {
+	return TLPFromTags(event.Tag)
+}
@@ -2,7 +2,7 @@ package misp
 
 import (
 	"bytes"
-	"crypto/tls"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -13,11 +13,25 @@ import (
 	"strconv"
 )
 
+// maxErrorBodySize caps how much of an error reply is kept in memory
+const maxErrorBodySize = 1 << 20
+
 // Client ... XXX
 type Client struct {
-	BaseURL    *url.URL
-	APIKey     string
+	BaseURL *url.URL
+	APIKey  string
+	// VerifyCert is only used when HTTPClient is nil, otherwise the TLS
+	// configuration of HTTPClient applies
 	VerifyCert bool
+	UserAgent  string
+	// HTTPClient sends every request. When nil a shared client honoring
+	// VerifyCert is used.
+	HTTPClient *http.Client
+	// Retry enables retrying failed requests, nil disables it
+	Retry *RetryPolicy
+	// Limiter throttles the requests, nil disables it. Response bodies must
+	// be closed to release their slot.
+	Limiter *Limiter
 }
 
 type InnerEventTag struct {
@@ -35,16 +49,32 @@ type eventTagResponse struct {
 	CheckPublish bool   `json:"check_publish"`
 }
 
-func NewClient(baseURL string, apiKey string) (Client, error) {
+func NewClient(baseURL string, apiKey string, opts ...ClientOption) (Client, error) {
+	cfg := clientConfig{verifyCert: true}
+	for _, opt := range opts {
+		if err := opt(&cfg); err != nil {
+			return Client{}, err
+		}
+	}
+
+	httpClient, err := cfg.buildHTTPClient()
+	if err != nil {
+		return Client{}, err
+	}
+
 	url, err := url.Parse(baseURL)
 	return Client{
 		BaseURL:    url,
 		APIKey:     apiKey,
-		VerifyCert: true,
+		VerifyCert: cfg.verifyCert,
+		UserAgent:  cfg.userAgent,
+		HTTPClient: httpClient,
+		Retry:      cfg.retry,
+		Limiter:    cfg.limiter,
 	}, err
 }
 
-func (client *Client) eventTagManagement(path string, eventID string, tag string) (bool, error) {
+func (client *Client) eventTagManagement(ctx context.Context, path string, eventID string, tag string) (bool, error) {
 	req := Request{
 		Request: EventTag{
 			Event: InnerEventTag{
@@ -54,7 +84,7 @@ func (client *Client) eventTagManagement(path string, eventID string, tag string
 		},
 	}
 
-	resp, err := client.Post(path, req)
+	resp, err := client.PostContext(ctx, path, req)
 	if err != nil {
 		return false, err
 	}
@@ -62,31 +92,47 @@ func (client *Client) eventTagManagement(path string, eventID string, tag string
 
 	var tagResponse eventTagResponse
 	d := json.NewDecoder(resp.Body)
-	d.Decode(&tagResponse)
+	if err = d.Decode(&tagResponse); err != nil && ctx.Err() != nil {
+		return false, ctx.Err()
+	}
 
-	return tagResponse.Saved, err
+	return tagResponse.Saved, nil
 }
 
 func (client *Client) RemoveEventTag(eventID string, tag string) (bool, error) {
-	return client.eventTagManagement("/events/removeTag", eventID, tag)
+	return client.RemoveEventTagContext(context.Background(), eventID, tag)
+}
+
+// RemoveEventTagContext is like RemoveEventTag but honors ctx
+func (client *Client) RemoveEventTagContext(ctx context.Context, eventID string, tag string) (bool, error) {
+	return client.eventTagManagement(ctx, "/events/removeTag", eventID, tag)
 }
 
 func (client *Client) AddEventTag(eventID string, tag string) (bool, error) {
-	return client.eventTagManagement("/events/addTag", eventID, tag)
+	return client.AddEventTagContext(context.Background(), eventID, tag)
 }
 
-// AddSighting ... XXX
-func (client *Client) AddSighting(s *Sighting) (*Response, error) {
-	httpResp, err := client.Post("/sightings/add/", Request{Request: s})
+// AddEventTagContext is like AddEventTag but honors ctx
+func (client *Client) AddEventTagContext(ctx context.Context, eventID string, tag string) (bool, error) {
+	return client.eventTagManagement(ctx, "/events/addTag", eventID, tag)
+}
+
+// postResponse posts req to path and decodes the generic MISP reply
+func (client *Client) postResponse(ctx context.Context, path string, req interface{}) (*Response, error) {
+	httpResp, err := client.PostContext(ctx, path, req)
 	if err != nil {
 		return nil, err
 	}
+	defer httpResp.Body.Close()
 
 	var response Response
 	decoder := json.NewDecoder(httpResp.Body)
 	if err = decoder.Decode(&response); err != nil {
 		return nil, err
 	}
+	if err = response.err(httpResp); err != nil {
+		return &response, err
+	}
 
 	return &response, nil
 }
@@ -103,22 +149,36 @@ type UploadResponse struct {
 
 // UploadSample ... XXX
 func (client *Client) UploadSample(sample *SampleUpload) (*UploadResponse, error) {
+	return client.UploadSampleContext(context.Background(), sample)
+}
+
+// UploadSampleContext is like UploadSample but honors ctx
+func (client *Client) UploadSampleContext(ctx context.Context, sample *SampleUpload) (*UploadResponse, error) {
 	req := &Request{Request: sample}
 
 	url := fmt.Sprintf("/events/upload_sample/%s", sample.EventID)
-	httpResp, err := client.Post(url, req)
+	httpResp, err := client.PostContext(ctx, url, req)
 	if err != nil {
 		return nil, err
 	}
+	defer httpResp.Body.Close()
 
-	var resp UploadResponse
-	decoder := json.NewDecoder(httpResp.Body)
-	if err = decoder.Decode(&resp); err != nil {
-		return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+	body, err := ioutil.ReadAll(httpResp.Body)
+	if err != nil {
+		return nil, err
 	}
 
-	if len(resp.Errors) > 0 {
-		return nil, fmt.Errorf("MISP returned an error: %v", resp)
+	// errors come in any of the shapes handled by APIError
+	var generic Response
+	if json.Unmarshal(body, &generic) == nil {
+		if err = generic.err(httpResp); err != nil {
+			return nil, err
+		}
+	}
+
+	var resp UploadResponse
+	if err = json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal response: %s", err)
 	}
 
 	id, err := strconv.ParseInt(resp.RawID, 10, 32)
@@ -130,28 +190,38 @@ func (client *Client) UploadSample(sample *SampleUpload) (*UploadResponse, error
 	return &resp, nil
 }
 
-// DownloadSample downloads a malware sample to the given file
+// DownloadSample downloads a malware sample to the given file, replacing
+// its content. The file is left untouched when MISP refuses the download.
 func (client *Client) DownloadSample(sampleID int, filename string) error {
-	path := fmt.Sprintf("/attributes/downloadAttachment/download/%d", sampleID)
+	return client.DownloadSampleContext(context.Background(), sampleID, filename)
+}
 
-	httpReq := &http.Request{}
-	httpReq.Method = "GET"
-	httpReq.URL = client.BaseURL
-	httpReq.URL.Path = path
+// DownloadSampleContext is like DownloadSample but honors ctx
+func (client *Client) DownloadSampleContext(ctx context.Context, sampleID int, filename string) error {
+	path := fmt.Sprintf("/attributes/downloadAttachment/download/%d", sampleID)
 
-	httpReq.Header = make(http.Header)
-	httpReq.Header.Set("Authorization", client.APIKey)
+	httpReq, err := client.newRequest(ctx, "GET", path, nil)
+	if err != nil {
+		return fmt.Errorf("Error downloading sample: %s", err.Error())
+	}
 
-	resp, err := http.DefaultClient.Do(httpReq)
+	resp, err := client.roundTrip(httpReq)
 	if err != nil {
 		return fmt.Errorf("Error downloading sample: %s", err.Error())
 	}
+	resp.Body = &contextReader{ctx: ctx, r: resp.Body}
+
+	// the error document must not end up in the file
+	if err = checkResponse(resp); err != nil {
+		return err
+	}
 	defer resp.Body.Close()
 
-	outFile, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0755)
+	outFile, err := os.OpenFile(filename, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0755)
 	if err != nil {
 		return fmt.Errorf("Error opening %s: %s", filename, err.Error())
 	}
+	defer outFile.Close()
 
 	_, err = io.Copy(outFile, resp.Body)
 	if err != nil {
@@ -166,76 +236,145 @@ func (client *Client) Get(path string, req interface{}) (*http.Response, error)
 	return client.Do("GET", path, req)
 }
 
+// GetContext is a wrapper to DoContext()
+func (client *Client) GetContext(ctx context.Context, path string, req interface{}) (*http.Response, error) {
+	return client.DoContext(ctx, "GET", path, req)
+}
+
 // Post is a wrapper to Do()
 func (client *Client) Post(path string, req interface{}) (*http.Response, error) {
 	return client.Do("POST", path, req)
 }
 
-// AddAttribute adds an attribute to an event
-func (client *Client) AddAttribute(eventID string, attr Attribute) (attribute Attribute, err error) {
-	var (
-		path   string = "/attributes/add/" + eventID
-		result map[string]json.RawMessage
-	)
-
-	resp, err := client.Post(path, attr)
-	if err != nil {
-		return
-	}
-	defer resp.Body.Close()
-
-	decoder := json.NewDecoder(resp.Body)
-	if err = decoder.Decode(&result); err != nil {
-		return attribute, fmt.Errorf("Could not unmarshal response: %s", err)
-	}
-	json.Unmarshal(result["Attribute"], &attribute)
-	return
+// PostContext is a wrapper to DoContext()
+func (client *Client) PostContext(ctx context.Context, path string, req interface{}) (*http.Response, error) {
+	return client.DoContext(ctx, "POST", path, req)
 }
 
 // Do set the HTTP headers, encode the data in the JSON format and send it to the
 // server.
-// It checks the HTTP response by looking at the status code and decodes the JSON structure
-// to a Response structure.
+// It checks the HTTP response by looking at the status code: any other than
+// 200 is returned as an *APIError, along the response whose body holds the
+// error document. The body of a successful response is left for the caller to
+// decode and close.
 func (client *Client) Do(method, path string, req interface{}) (*http.Response, error) {
-	dataLen := 0
-	httpReq := &http.Request{}
-	httpTrp := &http.Transport{
-		TLSClientConfig: &tls.Config{InsecureSkipVerify: !client.VerifyCert},
-	}
+	return client.DoContext(context.Background(), method, path, req)
+}
 
+// DoContext is like Do but the request is bound to ctx. Cancelling ctx aborts
+// the request and any pending read of the returned response body.
+func (client *Client) DoContext(ctx context.Context, method, path string, req interface{}) (*http.Response, error) {
+	return client.do(ctx, method, path, req, "application/json")
+}
+
+// do is DoContext asking for the given media type
+func (client *Client) do(ctx context.Context, method, path string, req interface{}, accept string) (*http.Response, error) {
+	var jsonBuf []byte
 	if req != nil {
-		jsonBuf, err := json.Marshal(req)
-		if err != nil {
+		var err error
+		if jsonBuf, err = json.Marshal(req); err != nil {
 			return nil, err
 		}
-		reader := bytes.NewReader(jsonBuf)
-		dataLen = reader.Len()
-		httpReq.Body = ioutil.NopCloser(reader)
 	}
 
-	httpReq.Method = method
-	httpReq.URL = client.BaseURL
-	httpReq.URL.Path = path
+	if client.Retry == nil || !client.Retry.retryable(ctx, method) {
+		return client.send(ctx, method, path, jsonBuf, accept)
+	}
+	return client.Retry.do(ctx, func() (*http.Response, error) {
+		return client.send(ctx, method, path, jsonBuf, accept)
+	})
+}
 
-	httpReq.Header = make(http.Header)
-	httpReq.Header.Set("Authorization", client.APIKey)
-	httpReq.Header.Set("Content-Type", "application/json")
-	if dataLen > 0 && method == "POST" {
-		httpReq.ContentLength = int64(dataLen)
+// send performs a single HTTP exchange with the MISP server
+func (client *Client) send(ctx context.Context, method, path string, jsonBuf []byte, accept string) (*http.Response, error) {
+	var body io.Reader
+	if jsonBuf != nil {
+		body = bytes.NewReader(jsonBuf)
 	}
-	httpReq.Header.Set("Accept", "application/json")
 
-	httpClient := http.Client{
-		Transport: httpTrp,
+	httpReq, err := client.newRequest(ctx, method, path, body)
+	if err != nil {
+		return nil, err
 	}
-	resp, err := httpClient.Do(httpReq)
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", accept)
+
+	resp, err := client.roundTrip(httpReq)
 	if err != nil {
 		return nil, err
 	}
+	resp.Body = &contextReader{ctx: ctx, r: resp.Body}
 
-	if resp.StatusCode != http.StatusOK {
-		return resp, fmt.Errorf("MISP server replied status=%d", resp.StatusCode)
+	if err = checkResponse(resp); err != nil {
+		return resp, err
 	}
 
 	return resp, nil
 }
+
+// checkResponse returns an *APIError when resp is not a success. The body is
+// then read and closed, a copy of it being left readable for callers
+// inspecting the response.
+func checkResponse(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	data, _ := ioutil.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewReader(data))
+	return newAPIError(resp, data)
+}
+
+// newRequest builds an authenticated request for path
+func (client *Client) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, method, client.url(path), body)
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Authorization", client.APIKey)
+	if client.UserAgent != "" {
+		httpReq.Header.Set("User-Agent", client.UserAgent)
+	}
+	return httpReq, nil
+}
+
+// httpClient returns the http.Client used to talk to the MISP instance
+func (client *Client) httpClient() *http.Client {
+	if client.HTTPClient != nil {
+		return client.HTTPClient
+	}
+	if client.VerifyCert {
+		return defaultHTTPClient
+	}
+	return insecureHTTPClient
+}
+
+// url returns the absolute URL of path on the MISP instance without touching
+// client.BaseURL
+func (client *Client) url(path string) string {
+	u := *client.BaseURL
+	u.Path = path
+	return u.String()
+}
+
+// contextReader stops reading from r as soon as ctx is done
+type contextReader struct {
+	ctx context.Context
+	r   io.ReadCloser
+}
+
+func (cr *contextReader) Read(p []byte) (int, error) {
+	if err := cr.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := cr.r.Read(p)
+	if err != nil && cr.ctx.Err() != nil {
+		err = cr.ctx.Err()
+	}
+	return n, err
+}
+
+func (cr *contextReader) Close() error {
+	return cr.r.Close()
+}
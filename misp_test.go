@@ -2,15 +2,20 @@ package misp
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"path/filepath"
 	"reflect"
+	"sync"
 	"testing"
+	"time"
 )
 
 var (
@@ -68,6 +73,172 @@ func Test_GetEvents(t *testing.T) {
 	}
 }
 
+func Test_NewClientOptions(t *testing.T) {
+	setup()
+	mux.HandleFunc("/events",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			testHeader(t, r, "User-Agent", "mispgo-test")
+			if r.Host != "misp.invalid" {
+				t.Errorf("Request was not proxied: host %q", r.Host)
+			}
+			fmt.Fprint(w, `[]`)
+		})
+
+	c, err := NewClient("http://misp.invalid", "dummyapikeyfortests",
+		WithProxy(server.URL),
+		WithUserAgent("mispgo-test"),
+		WithTimeout(5*time.Second),
+	)
+	if err != nil {
+		t.Fatalf("NewClient() failed: %v", err)
+	}
+	if c.HTTPClient == nil || c.HTTPClient.Timeout != 5*time.Second {
+		t.Errorf("NewClient() did not build a custom http.Client: %+v", c.HTTPClient)
+	}
+
+	if _, err = c.GetEvents(); err != nil {
+		t.Errorf("GetEvents() through proxy failed: %v", err)
+	}
+
+	_, err = NewClient("http://misp.invalid", "key",
+		WithHTTPClient(&http.Client{}),
+		WithProxy(server.URL),
+	)
+	if err == nil {
+		t.Errorf("NewClient() accepted WithHTTPClient together with WithProxy")
+	}
+}
+
+func Test_Retry(t *testing.T) {
+	setup()
+	client.Retry = &RetryPolicy{MaxAttempts: 3, MinBackoff: time.Millisecond}
+
+	calls := 0
+	mux.HandleFunc("/events",
+		func(w http.ResponseWriter, r *http.Request) {
+			calls++
+			if calls < 3 {
+				w.Header().Set("Retry-After", "0")
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `[]`)
+		})
+	if _, err := client.GetEvents(); err != nil || calls != 3 {
+		t.Errorf("GetEvents() returned %v after %d calls, want success after 3", err, calls)
+	}
+
+	searches := 0
+	mux.HandleFunc("/events/restSearch",
+		func(w http.ResponseWriter, r *http.Request) {
+			searches++
+			var got Search
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil || got.EventID != "1" {
+				t.Errorf("Request body was not replayed: %v %+v", err, got)
+			}
+			w.WriteHeader(http.StatusBadGateway)
+		})
+	_, err := client.SearchEvents(&Search{EventID: "1"})
+	var retryErr *RetryError
+	if !errors.As(err, &retryErr) || retryErr.Attempts != 3 || searches != 3 {
+		t.Errorf("SearchEvents() returned %v after %d calls, want a RetryError after 3", err, searches)
+	}
+	if apiErr, ok := AsAPIError(err); !ok || apiErr.StatusCode != http.StatusBadGateway {
+		t.Errorf("RetryError does not wrap the last APIError: %v", err)
+	}
+
+	adds := 0
+	mux.HandleFunc("/attributes/add/1",
+		func(w http.ResponseWriter, r *http.Request) {
+			adds++
+			w.WriteHeader(http.StatusServiceUnavailable)
+		})
+	if _, err := client.AddAttribute("1", Attribute{}); err == nil || adds != 1 {
+		t.Errorf("AddAttribute() was retried %d times", adds)
+	}
+
+	adds = 0
+	client.Retry.RetryAll = true
+	if _, err := client.AddAttribute("1", Attribute{}); err == nil || adds != 3 {
+		t.Errorf("AddAttribute() was sent %d times with RetryAll, want 3", adds)
+	}
+
+	// a day long Retry-After is capped by MaxBackoff
+	client.Retry.MaxBackoff = 10 * time.Millisecond
+	throttled := 0
+	mux.HandleFunc("/users/view/me",
+		func(w http.ResponseWriter, r *http.Request) {
+			throttled++
+			if throttled == 1 {
+				w.Header().Set("Retry-After", "86400")
+				w.WriteHeader(http.StatusTooManyRequests)
+				return
+			}
+			fmt.Fprint(w, `{}`)
+		})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	resp, err := client.GetContext(ctx, "/users/view/me", nil)
+	if err != nil || throttled != 2 {
+		t.Errorf("GetContext() returned %v after %d calls, want success after 2", err, throttled)
+	} else {
+		resp.Body.Close()
+	}
+}
+
+func Test_Limiter(t *testing.T) {
+	setup()
+	client.Limiter = NewLimiter(0, 0, 2)
+
+	var (
+		mu               sync.Mutex
+		current, maximum int
+	)
+	mux.HandleFunc("/events",
+		func(w http.ResponseWriter, r *http.Request) {
+			mu.Lock()
+			current++
+			if current > maximum {
+				maximum = current
+			}
+			mu.Unlock()
+			time.Sleep(10 * time.Millisecond)
+			mu.Lock()
+			current--
+			mu.Unlock()
+			fmt.Fprint(w, `[]`)
+		})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 6; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := client.GetEvents(); err != nil {
+				t.Errorf("GetEvents() failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if maximum > 2 {
+		t.Errorf("%d requests were in flight, want at most 2", maximum)
+	}
+	if n := client.Limiter.InFlight(); n != 0 {
+		t.Errorf("%d slots were not released", n)
+	}
+
+	client.Limiter.SetRate(1, 1)
+	if _, err := client.GetEvents(); err != nil {
+		t.Errorf("GetEvents() failed: %v", err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if _, err := client.GetEventsContext(ctx); err != context.DeadlineExceeded {
+		t.Errorf("GetEventsContext() returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
 func Test_SearchEvents(t *testing.T) {
 	setup()
 	mux.HandleFunc("/events/restSearch",
@@ -86,6 +257,25 @@ func Test_SearchEvents(t *testing.T) {
 	}
 }
 
+func Test_SearchEventsContextCanceled(t *testing.T) {
+	setup()
+	mux.HandleFunc("/events/restSearch",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"response": [`)
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		})
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err := client.SearchEventsContext(ctx, &Search{EventID: "1"})
+	if err != context.DeadlineExceeded {
+		t.Errorf("SearchEventsContext() returned %v, want %v", err, context.DeadlineExceeded)
+	}
+}
+
 func Test_SearchIndex(t *testing.T) {
 	setup()
 	mux.HandleFunc("/events/index",
@@ -314,6 +504,87 @@ func Test_AddEvent(t *testing.T) {
 	}
 }
 
+func Test_UpdateEvent(t *testing.T) {
+	setup()
+	mux.HandleFunc("/events/edit/1",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json UpdateEvent request: %s", err)
+			}
+			if _, ok := got["published"]; ok {
+				t.Errorf("UpdateEvent() sent the published flag")
+			}
+			if _, ok := got["timestamp"]; ok {
+				t.Errorf("UpdateEvent() sent the timestamp")
+			}
+			attributes := got["Attribute"].([]interface{})
+			for _, obj := range got["Object"].([]interface{}) {
+				obj := obj.(map[string]interface{})
+				if _, ok := obj["timestamp"]; ok {
+					t.Errorf("UpdateEvent() sent an object timestamp")
+				}
+				attributes = append(attributes, obj["Attribute"].([]interface{})...)
+			}
+			if len(attributes) != 2 {
+				t.Errorf("UpdateEvent() sent %d attributes, want 2", len(attributes))
+			}
+			for _, attr := range attributes {
+				if _, ok := attr.(map[string]interface{})["timestamp"]; ok {
+					t.Errorf("UpdateEvent() sent an attribute timestamp: %v", attr)
+				}
+			}
+			fmt.Fprintf(w, `{"Event":{"id":"1","info":%q}}`, got["info"])
+		})
+
+	event := NewEvent()
+	event.ID = "1"
+	event.Info = "updated"
+	event.Attribute = []Attribute{{Value: "1.2.3.4", Type: "ip-dst", Timestamp: NewUnixTime(time.Now())}}
+	obj := NewFileObject()
+	obj.AddAttribute("md5", "md5", "68b329da9893e34099c7d8ad5cb9c940")
+	event.Object = []Object{obj}
+	updated, err := client.UpdateEvent(event)
+	if err != nil {
+		t.Errorf("UpdateEvent() failed: %v", err)
+	}
+	if updated.Info != "updated" {
+		t.Errorf("UpdateEvent() returned info %q, want %q", updated.Info, "updated")
+	}
+}
+
+func Test_EventLifecycle(t *testing.T) {
+	setup()
+	replies := map[string]string{
+		"publish":   "Event published.",
+		"unpublish": "Event unpublished.",
+		"delete":    "Event deleted.",
+	}
+	for action, message := range replies {
+		action, message := action, message
+		mux.HandleFunc("/events/"+action+"/1",
+			func(w http.ResponseWriter, r *http.Request) {
+				testMethod(t, r, "POST")
+				fmt.Fprintf(w, `{"name":%q,"message":%q,"url":"\/events\/%s\/1"}`, message, message, action)
+			})
+	}
+
+	resp, err := client.PublishEvent("1", false)
+	if err != nil || resp == nil || resp.Message != "Event published." {
+		t.Errorf("PublishEvent() returned (%+v, %v)", resp, err)
+	}
+	resp, err = client.UnpublishEvent("1")
+	if err != nil || resp == nil || resp.Message != "Event unpublished." {
+		t.Errorf("UnpublishEvent() returned (%+v, %v)", resp, err)
+	}
+	resp, err = client.DeleteEvent("1")
+	if err != nil || resp == nil || resp.URL != "/events/delete/1" {
+		t.Errorf("DeleteEvent() returned (%+v, %v)", resp, err)
+	}
+}
+
 func Test_EventExists(t *testing.T) {
 	setup()
 	mux.HandleFunc("/events/view/1",
@@ -329,6 +600,42 @@ func Test_EventExists(t *testing.T) {
 	}
 }
 
+func Test_EventExistsNotFound(t *testing.T) {
+	setup()
+	mux.HandleFunc("/events/view/2",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"name":"Invalid event","message":"Invalid event","url":"\/events\/view\/2"}`)
+		})
+
+	exists, err := client.EventExists("2")
+	if err != nil || exists {
+		t.Errorf("EventExists() returned (%v, %v), want (false, nil)", exists, err)
+	}
+}
+
+func Test_APIErrorValidation(t *testing.T) {
+	setup()
+	mux.HandleFunc("/attributes/add/1",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"saved":false,"name":"Could not add Attribute","message":"Could not add Attribute","url":"\/attributes\/add","errors":{"Attribute":{"value":["Value not in the right type\/format."],"type":["Options depend on the selected category."]}}}`)
+		})
+
+	_, err := client.AddAttribute("1", Attribute{Type: "ip-dst", Value: "nope"})
+	if !IsValidationError(err) {
+		t.Fatalf("AddAttribute() error is not a validation error: %#v", err)
+	}
+	apiErr, _ := AsAPIError(err)
+	want := map[string][]string{
+		"Attribute.value": {"Value not in the right type/format."},
+		"Attribute.type":  {"Options depend on the selected category."},
+	}
+	if !reflect.DeepEqual(apiErr.ValidationErrors, want) {
+		t.Errorf("Wrong ValidationErrors: got %v, want %v", apiErr.ValidationErrors, want)
+	}
+}
+
 func Test_AddSightingNotFound(t *testing.T) {
 	setup()
 
@@ -348,6 +655,17 @@ func Test_AddSightingNotFound(t *testing.T) {
 	if err == nil {
 		t.Errorf("AddSighting() did not returned an error, I was expecting status=403")
 	}
+	if !IsForbidden(err) {
+		t.Errorf("AddSighting() error is not a 403 APIError: %#v", err)
+	}
+	if apiErr, ok := AsAPIError(err); ok {
+		if apiErr.Path != "/sightings/add/" || apiErr.Message != "Could not add Sighting" {
+			t.Errorf("Wrong APIError: %#v", apiErr)
+		}
+		if len(apiErr.Errors) != 1 || apiErr.Errors[0] != "No valid attributes found that match the criteria." {
+			t.Errorf("Wrong APIError.Errors: %#v", apiErr.Errors)
+		}
+	}
 
 }
 
@@ -415,7 +733,7 @@ func Test_SearchAttributes(t *testing.T) {
 			Type:               "filename|md5",
 			ToIDS:              true,
 			UUID:               "58b98766-73cc-437f-a814-4a9a0a3ac101",
-			Timestamp:          "1488553830",
+			Timestamp:          UnixTime{time.Unix(1488553830, 0)},
 			Distribution:       "5",
 			SharingGroupID:     "0",
 			Deleted:            false,
@@ -432,7 +750,7 @@ func Test_SearchAttributes(t *testing.T) {
 			Type:               "md5",
 			ToIDS:              true,
 			UUID:               "58b98dc1-b698-4172-b274-4ae30a3ac101",
-			Timestamp:          "1488557887",
+			Timestamp:          UnixTime{time.Unix(1488557887, 0)},
 			Distribution:       "5",
 			SharingGroupID:     "0",
 			Deleted:            false,
@@ -472,7 +790,8 @@ func Test_UploadSample_Failed(t *testing.T) {
 		})
 
 	_, err := client.UploadSample(s)
-	if err == nil {
+	apiErr, ok := AsAPIError(err)
+	if !ok || len(apiErr.Errors) != 1 || apiErr.Path != "/events/upload_sample/3" {
 		t.Errorf("UploadSample returned error: %v", err)
 	}
 }
@@ -586,12 +905,27 @@ func Test_DownloadSample(t *testing.T) {
 
 			w.Write([]byte{0xAB, 0xCD, 0xEF, 0x13, 0x37})
 		})
+	mux.HandleFunc("/attributes/downloadAttachment/download/404",
+		func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			fmt.Fprint(w, `{"name": "Invalid attribute", "message": "Invalid attribute", "url": "/attributes/downloadAttachment/download/404"}`)
+		})
+
+	// an older and larger file is replaced
+	if err := ioutil.WriteFile("test_DownloadSample.bin", bytes.Repeat([]byte{0xFF}, 16), 0644); err != nil {
+		t.Fatalf("WriteFile returned an error: %s", err)
+	}
+	defer os.Remove("test_DownloadSample.bin")
 
 	err := client.DownloadSample(1234, "test_DownloadSample.bin")
 	if err != nil {
 		t.Errorf("DownloadSample returned an error: %s", err)
 	}
-	defer os.Remove("test_DownloadSample.bin")
+
+	err = client.DownloadSample(404, "test_DownloadSample.bin")
+	if !IsNotFound(err) {
+		t.Errorf("DownloadSample returned %v, want a 404", err)
+	}
 
 	result, err := ioutil.ReadFile("test_DownloadSample.bin")
 	if err != nil {
@@ -673,3 +1007,1300 @@ func TestAddAttribute(t *testing.T) {
 		t.Errorf("Returned Type attribute does not match: got %v, expecting %v", newAttr.Type, attr.Type)
 	}
 }
+
+func Test_AddAttributes(t *testing.T) {
+	setup()
+
+	attrs := []Attribute{
+		{Value: "1.2.3.4", Type: "ip-dst", Category: "Network activity"},
+		{Value: "nope", Type: "ip-dst", Category: "Network activity"},
+		{Value: "example.com", Type: "domain", Category: "Network activity"},
+	}
+
+	mux.HandleFunc("/attributes/add/1234",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got []Attribute
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil || len(got) != 3 {
+				t.Errorf("Cannot decode json AddAttributes request: %v", err)
+			}
+			fmt.Fprint(w, `{"Attribute":[{"id":"1","event_id":"1234","value":"1.2.3.4"},{"id":"2","event_id":"1234","value":"example.com"}],"errors":{"1":{"value":["Value not in the right type\/format."]}}}`)
+		})
+
+	results, err := client.AddAttributes("1234", attrs)
+	if err != nil {
+		t.Fatalf("AddAttributes returned an error: %s", err)
+	}
+	if len(results) != 3 {
+		t.Fatalf("AddAttributes returned %d results, want 3", len(results))
+	}
+	if results[0].Err != nil || results[0].Attribute.ID != "1" {
+		t.Errorf("Wrong result for attribute 0: %+v", results[0])
+	}
+	if !IsValidationError(results[1].Err) {
+		t.Errorf("Wrong result for attribute 1: %+v", results[1])
+	}
+	if results[2].Err != nil || results[2].Attribute.Value != "example.com" {
+		t.Errorf("Wrong result for attribute 2: %+v", results[2])
+	}
+}
+
+func Test_AttributeLifecycle(t *testing.T) {
+	setup()
+
+	reply := `{"Attribute":{"id":"42","event_id":"1","type":"ip-dst","value":"1.2.3.4","to_ids":false,"comment":"edited"}}`
+	mux.HandleFunc("/attributes/view/42",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, reply)
+		})
+	mux.HandleFunc("/attributes/edit/42",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			var got map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json UpdateAttribute request: %s", err)
+			}
+			if _, ok := got["timestamp"]; ok {
+				t.Errorf("UpdateAttribute() sent the timestamp")
+			}
+			fmt.Fprint(w, reply)
+		})
+	mux.HandleFunc("/attributes/delete/42/1",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"message":"Attribute deleted."}`)
+		})
+	mux.HandleFunc("/attributes/restore/42",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, reply)
+		})
+
+	attr, err := client.GetAttribute("42")
+	if err != nil || attr.ID != "42" {
+		t.Errorf("GetAttribute() returned (%+v, %v)", attr, err)
+	}
+
+	attr.Comment = "edited"
+	attr, err = client.UpdateAttribute(attr)
+	if err != nil || attr.Comment != "edited" {
+		t.Errorf("UpdateAttribute() returned (%+v, %v)", attr, err)
+	}
+
+	resp, err := client.DeleteAttribute("42", true)
+	if err != nil || resp.Message != "Attribute deleted." {
+		t.Errorf("DeleteAttribute() returned (%+v, %v)", resp, err)
+	}
+
+	attr, err = client.RestoreAttribute("42")
+	if err != nil || attr.ID != "42" {
+		t.Errorf("RestoreAttribute() returned (%+v, %v)", attr, err)
+	}
+}
+
+func Test_AddObject(t *testing.T) {
+	setup()
+
+	obj := NewFileObject()
+	obj.AddAttribute("filename", "filename", "evil.exe")
+	obj.AddAttribute("md5", "md5", "68b329da9893e34099c7d8ad5cb9c940").ToIDS = true
+
+	mux.HandleFunc("/objects/add/1234/"+FileTemplateUUID,
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got Object
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json AddObject request: %s", err)
+			}
+			if got.Name != "file" || len(got.Attribute) != 2 || !got.Attribute[1].ToIDS {
+				t.Errorf("AddObject sent %+v", got)
+			}
+			got.ID = "7"
+			got.EventID = "1234"
+			d, _ := json.Marshal(map[string]Object{"Object": got})
+			w.Write(d)
+		})
+
+	added, err := client.AddObject("1234", obj)
+	if err != nil {
+		t.Fatalf("AddObject returned an error: %s", err)
+	}
+	if added.ID != "7" || added.UUID != obj.UUID {
+		t.Errorf("AddObject returned %+v", added)
+	}
+
+	mux.HandleFunc("/objects/edit/7",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json UpdateObject request: %s", err)
+			}
+			if _, ok := got["timestamp"]; ok {
+				t.Errorf("UpdateObject sent the object timestamp")
+			}
+			for _, item := range got["Attribute"].([]interface{}) {
+				if _, ok := item.(map[string]interface{})["timestamp"]; ok {
+					t.Errorf("UpdateObject sent an attribute timestamp: %v", item)
+				}
+			}
+			fmt.Fprint(w, `{"Object": {"id": "7", "name": "file"}}`)
+		})
+
+	added.Attribute[0].Value = "evil.dll"
+	added.Attribute[0].Timestamp = NewUnixTime(time.Now())
+	if _, err = client.UpdateObject(added); err != nil {
+		t.Errorf("UpdateObject returned an error: %s", err)
+	}
+
+	mux.HandleFunc("/objectReferences/add/"+obj.UUID,
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+
+			var got ObjectReference
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json AddObjectReference request: %s", err)
+			}
+			got.ID = "3"
+			d, _ := json.Marshal(map[string]ObjectReference{"ObjectReference": got})
+			w.Write(d)
+		})
+
+	ref := obj.AddReference("5dd790ad-b0ec-4b8a-bc97-2ed00a3a5cd9", "drops")
+	created, err := client.AddObjectReference(*ref)
+	if err != nil {
+		t.Fatalf("AddObjectReference returned an error: %s", err)
+	}
+	if created.ID != "3" || created.RelationshipType != "drops" {
+		t.Errorf("AddObjectReference returned %+v", created)
+	}
+}
+
+const testFileTemplate = `{
+  "attributes": {
+    "filename": {"misp-attribute": "filename", "ui-priority": 1, "categories": ["Payload delivery", "Artifacts dropped"]},
+    "md5": {"misp-attribute": "md5", "ui-priority": 1, "to_ids": true, "categories": ["Payload delivery"]},
+    "state": {"misp-attribute": "text", "ui-priority": 0, "multiple": true, "values_list": ["Malicious", "Harmless"]}
+  },
+  "description": "File object describing a file with meta-information",
+  "meta-category": "file",
+  "name": "file",
+  "requiredOneOf": ["filename", "md5"],
+  "uuid": "688c46fb-5edb-40a3-8273-1af7923e2215",
+  "version": 24
+}`
+
+func Test_TemplateRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mispgo")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	os.MkdirAll(dir+"/objects/file", 0755)
+	ioutil.WriteFile(dir+"/objects/file/definition.json", []byte(testFileTemplate), 0644)
+
+	registry := NewTemplateRegistry()
+	if err = registry.LoadDir(dir); err != nil {
+		t.Fatalf("LoadDir returned an error: %s", err)
+	}
+	if names := registry.Names(); !reflect.DeepEqual(names, []string{"file"}) {
+		t.Errorf("Names returned %v", names)
+	}
+
+	b, err := registry.NewObjectFromTemplate("file")
+	if err != nil {
+		t.Fatalf("NewObjectFromTemplate returned an error: %s", err)
+	}
+	if _, err = b.Object(); err == nil {
+		t.Errorf("Object accepted an object without any of the requiredOneOf relations")
+	}
+	attr, err := b.Set("md5", "68b329da9893e34099c7d8ad5cb9c940")
+	if err != nil || attr.Type != "md5" || !attr.ToIDS || attr.Category != "Payload delivery" {
+		t.Errorf("Set returned (%+v, %v)", attr, err)
+	}
+	if _, err = b.Set("md5", "68b329da9893e34099c7d8ad5cb9c940"); err == nil {
+		t.Errorf("Set accepted a non multiple relation twice")
+	}
+	if _, err = b.Set("state", "Unknown"); err == nil {
+		t.Errorf("Set accepted a value out of values_list")
+	}
+	if _, err = b.Set("sha1", "foo"); err == nil {
+		t.Errorf("Set accepted an unknown relation")
+	}
+	obj, err := b.Object()
+	if err != nil {
+		t.Errorf("Object returned an error: %s", err)
+	}
+	if obj.TemplateUUID != FileTemplateUUID || obj.TemplateVersion != "24" {
+		t.Errorf("Object returned %+v", obj)
+	}
+
+	obj.AddAttribute("size", "size-in-bytes", "12")
+	obj.AddAttribute("filename", "text", "evil.exe")
+	err = registry.Validate(obj)
+	verr, ok := err.(*ObjectValidationError)
+	if !ok || len(verr.Problems) != 2 {
+		t.Errorf("Validate returned %v, want 2 problems", err)
+	}
+}
+
+func Test_TemplateRegistryLoadFromServer(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/objectTemplates/index",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `[{"ObjectTemplate":{"id":"1","uuid":"688c46fb-5edb-40a3-8273-1af7923e2215","name":"file","version":"24","active":true}},{"ObjectTemplate":{"id":"2","name":"domain-ip","active":true}}]`)
+		})
+	mux.HandleFunc("/objectTemplates/view/1",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `{"ObjectTemplate":{"id":"1","uuid":"688c46fb-5edb-40a3-8273-1af7923e2215","name":"file","meta-category":"file","version":"24","active":true,"requirements":{"requiredOneOf":["filename","md5"]}},"ObjectTemplateElement":[{"object_relation":"md5","type":"md5","ui-priority":"1","categories":["Payload delivery"],"sane_default":[],"values_list":[],"multiple":false}]}`)
+		})
+
+	registry := NewTemplateRegistry()
+	if err := registry.LoadFromServer(context.Background(), client, "file"); err != nil {
+		t.Fatalf("LoadFromServer returned an error: %s", err)
+	}
+	tmpl, ok := registry.Get(FileTemplateUUID)
+	if !ok || tmpl.Version != 24 || tmpl.Attributes["md5"].MISPAttribute != "md5" {
+		t.Errorf("LoadFromServer registered %+v", tmpl)
+	}
+}
+
+func Test_ValidateCategoryType(t *testing.T) {
+	if err := ValidateCategoryType(CategoryNetworkActivity, "ip-dst"); err != nil {
+		t.Errorf("ValidateCategoryType rejected ip-dst in Network activity: %s", err)
+	}
+	if err := ValidateCategoryType(CategoryPersistenceMechanism, "ip-dst"); err == nil {
+		t.Errorf("ValidateCategoryType accepted ip-dst in Persistence mechanism")
+	}
+	if err := (Attribute{Category: "Network activitee", Type: "ip-dst"}).Validate(); err == nil {
+		t.Errorf("Validate accepted an unknown category")
+	}
+
+	categories := DefaultTypeMatrix.Categories("regkey")
+	want := []Category{CategoryArtifactsDropped, CategoryPersistenceMechanism, CategoryExternalAnalysis}
+	if !reflect.DeepEqual(categories, want) {
+		t.Errorf("Categories returned %v, want %v", categories, want)
+	}
+}
+
+func Test_DescribeTypes(t *testing.T) {
+	setup()
+	mux.HandleFunc("/attributes/describeTypes.json",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "GET")
+			fmt.Fprint(w, `{"result":{"types":["ip-dst","new-type"],"categories":["Network activity"],"category_type_mappings":{"Network activity":["ip-dst","new-type"]}}}`)
+		})
+
+	matrix, err := client.DescribeTypes()
+	if err != nil {
+		t.Fatalf("DescribeTypes returned an error: %s", err)
+	}
+	if !matrix.Allows(CategoryNetworkActivity, "new-type") {
+		t.Errorf("DescribeTypes returned %v", matrix)
+	}
+}
+
+func Test_TimeTypes(t *testing.T) {
+	var got struct {
+		Timestamp        UnixTime `json:"timestamp"`
+		PublishTimestamp UnixTime `json:"publish_timestamp"`
+		Number           UnixTime `json:"number"`
+		Date             MISPDate `json:"date"`
+		FirstSeen        SeenTime `json:"first_seen"`
+		LastSeen         SeenTime `json:"last_seen"`
+		Null             SeenTime `json:"null"`
+	}
+	data := `{"timestamp":"1617875568","publish_timestamp":"0","number":1617875568,"date":"1991-01-15","first_seen":"1581984000000001","last_seen":"2020-02-18T00:00:00.000001+00:00","null":null}`
+	if err := json.Unmarshal([]byte(data), &got); err != nil {
+		t.Fatalf("Unmarshal returned an error: %s", err)
+	}
+
+	if got.Timestamp.Unix() != 1617875568 || !got.Number.Equal(got.Timestamp.Time) {
+		t.Errorf("Wrong UnixTime: %v %v", got.Timestamp, got.Number)
+	}
+	if !got.PublishTimestamp.IsZero() || !got.Null.IsZero() {
+		t.Errorf("Unset values are not zero: %v %v", got.PublishTimestamp, got.Null)
+	}
+	if got.Date.Year() != 1991 || got.Date.Month() != time.January || got.Date.Day() != 15 {
+		t.Errorf("Wrong MISPDate: %v", got.Date)
+	}
+	if !got.FirstSeen.Equal(got.LastSeen.Time) || got.FirstSeen.Nanosecond() != 1000 {
+		t.Errorf("Wrong SeenTime: %v %v", got.FirstSeen, got.LastSeen)
+	}
+
+	want := `{"timestamp":"1617875568","publish_timestamp":"0","number":"1617875568","date":"1991-01-15","first_seen":"2020-02-18T00:00:00.000001Z","last_seen":"2020-02-18T00:00:00.000001Z","null":null}`
+	got.FirstSeen = SeenTime{got.FirstSeen.UTC()}
+	got.LastSeen = SeenTime{got.LastSeen.UTC()}
+	if out, _ := json.Marshal(got); string(out) != want {
+		t.Errorf("Marshal returned %s, want %s", out, want)
+	}
+}
+
+// testdata/ holds restSearch and sighting replies shaped like the ones of
+// MISP 2.4.1xx (string scalars) and 2.5 (numbers, "0"/"1" booleans and nulls)
+func Test_DecodeCorpus(t *testing.T) {
+	files, _ := filepath.Glob("testdata/restsearch-events-*.json")
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result SearchEventsResult
+		if err = json.Unmarshal(data, &result); err != nil {
+			t.Errorf("%s: Unmarshal returned an error: %s", file, err)
+			continue
+		}
+
+		event := result.Response[0]["Event"]
+		if event.ID != "12" || event.AttributeCount != 1 || event.Published || event.Distribution != DistributionThisCommunityOnly {
+			t.Errorf("%s: wrong event %+v", file, event)
+		}
+		if event.Timestamp.Unix() != 1617875568 || !event.PublishTimestamp.IsZero() {
+			t.Errorf("%s: wrong event timestamps %v %v", file, event.Timestamp, event.PublishTimestamp)
+		}
+		attr := event.Attribute[0]
+		if attr.ID != "610744" || !attr.ToIDS || attr.Deleted || attr.Distribution != DistributionInheritEvent {
+			t.Errorf("%s: wrong attribute %+v", file, attr)
+		}
+		if tag := event.Tag[0]; !tag.Exportable || tag.Inherited != 0 || tag.ID != "3" {
+			t.Errorf("%s: wrong tag %+v", file, tag)
+		}
+		if feed := event.Feed; feed.ID != "2" || !feed.CachingEnabled || feed.CacheTimestamp != "1617875568" {
+			t.Errorf("%s: wrong feed %+v", file, feed)
+		}
+	}
+
+	files, _ = filepath.Glob("testdata/restsearch-attributes-*.json")
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result SearchAttributesResult
+		if err = json.Unmarshal(data, &result); err != nil {
+			t.Errorf("%s: Unmarshal returned an error: %s", file, err)
+			continue
+		}
+		for _, attr := range result.Response["Attribute"] {
+			if attr.ID != "610744" || attr.EventID != "12" || attr.FirstSeen.Unix() != 1617875568 {
+				t.Errorf("%s: wrong attribute %+v", file, attr)
+			}
+		}
+	}
+
+	files, _ = filepath.Glob("testdata/sightings-*.json")
+	for _, file := range files {
+		data, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var result []struct {
+			Sighting Sighting `json:"Sighting"`
+		}
+		if err = json.Unmarshal(data, &result); err != nil {
+			t.Errorf("%s: Unmarshal returned an error: %s", file, err)
+			continue
+		}
+		s := result[0].Sighting
+		if s.ID != "5" || s.AttributeID != "610744" || s.Type != SightingTypeSighting || s.DateSighting.Unix() != 1617875568 {
+			t.Errorf("%s: wrong sighting %+v", file, s)
+		}
+	}
+}
+
+func Test_IterateAttributes(t *testing.T) {
+	setup()
+
+	pages := 0
+	mux.HandleFunc("/attributes/restSearch",
+		func(w http.ResponseWriter, r *http.Request) {
+			var got Search
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json SearchQuery request: %s", err)
+			}
+			pages++
+			if got.Page != pages || got.Limit != 2 {
+				t.Errorf("Request for page %d limit %d, want page %d limit 2", got.Page, got.Limit, pages)
+			}
+			switch got.Page {
+			case 1:
+				fmt.Fprint(w, `{"response":{"Attribute":[{"id":"1"},{"id":"2"}]}}`)
+			case 2:
+				fmt.Fprint(w, `{"response":{"Attribute":[{"id":"3"}]}}`)
+			default:
+				fmt.Fprint(w, `{"response":[]}`)
+			}
+		})
+
+	search := &Search{EventID: "1", Limit: 2}
+	it := client.IterateAttributes(context.Background(), search)
+	var ids []string
+	for it.Next() {
+		ids = append(ids, string(it.Value().ID))
+	}
+	if err := it.Err(); err != nil {
+		t.Errorf("IterateAttributes failed: %s", err)
+	}
+	if !reflect.DeepEqual(ids, []string{"1", "2", "3"}) || pages != 3 {
+		t.Errorf("IterateAttributes returned %v in %d pages", ids, pages)
+	}
+	if search.Page != 0 {
+		t.Errorf("IterateAttributes modified the search")
+	}
+
+	pages = 0
+	ctx, cancel := context.WithCancel(context.Background())
+	it = client.IterateAttributes(ctx, search)
+	it.Next()
+	cancel()
+	if it.Next() || it.Err() != context.Canceled {
+		t.Errorf("IterateAttributes did not stop on cancel: %v", it.Err())
+	}
+}
+
+func Test_IterateIndex(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/events/index",
+		func(w http.ResponseWriter, r *http.Request) {
+			var got IndexSearch
+			json.NewDecoder(r.Body).Decode(&got)
+			if got.Page == 1 {
+				fmt.Fprint(w, `[{"id":"1"},{"id":"2"}]`)
+				return
+			}
+			fmt.Fprint(w, `[]`)
+		})
+
+	it := client.IterateIndex(context.Background(), nil)
+	n := 0
+	for it.Next() {
+		n++
+	}
+	if it.Err() != nil || n != 2 {
+		t.Errorf("IterateIndex returned %d events, error %v", n, it.Err())
+	}
+
+	mux.HandleFunc("/events/restSearch",
+		func(w http.ResponseWriter, r *http.Request) {
+			var got Search
+			json.NewDecoder(r.Body).Decode(&got)
+			if got.Page == 1 && got.Limit == DefaultPageSize {
+				fmt.Fprint(w, `{"response": [{"Event": {"id": "1"}}]}`)
+				return
+			}
+			fmt.Fprint(w, `{"response": []}`)
+		})
+
+	it = client.IterateEvents(context.Background(), nil)
+	n = 0
+	for it.Next() {
+		n++
+	}
+	if it.Err() != nil || n != 1 {
+		t.Errorf("IterateEvents returned %d events, error %v", n, it.Err())
+	}
+}
+
+func Test_StreamAttributes(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/attributes/restSearch",
+		func(w http.ResponseWriter, r *http.Request) {
+			testMethod(t, r, "POST")
+			fmt.Fprint(w, `{"response":{"Attribute":[`)
+			for i := 1; i <= 1000; i++ {
+				if i > 1 {
+					fmt.Fprint(w, ",")
+				}
+				fmt.Fprintf(w, `{"id":"%d","type":"ip-dst","value":"10.0.0.1","Tag":[{"id":"1","name":"tlp:white"}]}`, i)
+			}
+			fmt.Fprint(w, `]}}`)
+		})
+
+	n := 0
+	err := client.StreamAttributes(context.Background(), &Search{}, func(attr Attribute) error {
+		n++
+		if attr.ID != FlexString(fmt.Sprint(n)) {
+			t.Errorf("Attribute %d has ID %s", n, attr.ID)
+		}
+		return nil
+	})
+	if err != nil || n != 1000 {
+		t.Errorf("StreamAttributes returned %v after %d attributes", err, n)
+	}
+
+	stop := errors.New("stop")
+	n = 0
+	err = client.StreamAttributes(context.Background(), &Search{}, func(attr Attribute) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Errorf("StreamAttributes returned %v after %d attributes, want the callback error after 1", err, n)
+	}
+}
+
+func Test_StreamEvents(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/events/restSearch",
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"response":[{"Event":{"id":"1","Attribute":[{"id":"1"}]}},{"Event":{"id":"2"}}]}`)
+		})
+
+	var ids []string
+	err := client.StreamEvents(context.Background(), &Search{}, func(event Event) error {
+		ids = append(ids, string(event.ID))
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(ids, []string{"1", "2"}) {
+		t.Errorf("StreamEvents returned %v, events %v", err, ids)
+	}
+
+	mux.HandleFunc("/attributes/restSearch",
+		func(w http.ResponseWriter, r *http.Request) {
+			fmt.Fprint(w, `{"response":[]}`)
+		})
+	err = client.StreamAttributes(context.Background(), &Search{}, func(attr Attribute) error {
+		t.Errorf("StreamAttributes called back on an empty reply")
+		return nil
+	})
+	if err != nil {
+		t.Errorf("StreamAttributes returned %v on an empty reply", err)
+	}
+}
+
+func Test_Export(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/attributes/restSearch",
+		func(w http.ResponseWriter, r *http.Request) {
+			var got Search
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json SearchQuery request: %s", err)
+			}
+			switch got.ReturnFormat {
+			case "csv":
+				testHeader(t, r, "Accept", "text/csv")
+				fmt.Fprint(w, "uuid,event_id,category,type,value,comment,to_ids,date,object_relation,attribute_tag,object_uuid,object_name,object_meta_category\n"+
+					"\"58b98766-73cc-437f-a814-4a9a0a3ac101\",6871,\"Payload delivery\",\"md5\",\"68b329da9893e34099c7d8ad5cb9c940\",\"my, comment\",1,20170303,\"\",\"tlp:white\",\"\",\"\",\"\"\n")
+			case "hashes":
+				fmt.Fprint(w, "68b329da9893e34099c7d8ad5cb9c940\n\nd41d8cd98f00b204e9800998ecf8427e\n")
+			case "suricata":
+				fmt.Fprint(w, "# MISP export of IDS rules - optimized for suricata\nalert ip any any -> 1.2.3.4 any (msg: \"MISP e6871 [] Outgoing To IP: 1.2.3.4\"; sid:1;)\n")
+			case "text":
+				fmt.Fprint(w, "68b329da9893e34099c7d8ad5cb9c940\n")
+			default:
+				t.Errorf("Unexpected returnFormat %q", got.ReturnFormat)
+			}
+		})
+
+	search := &Search{EventID: "6871"}
+	var buf bytes.Buffer
+	n, err := client.Export(context.Background(), "attributes", ExportSuricata, search, &buf)
+	if err != nil || n != int64(buf.Len()) || !bytes.Contains(buf.Bytes(), []byte("alert ip any any")) {
+		t.Errorf("Export returned (%d, %v): %s", n, err, buf.String())
+	}
+	if search.ReturnFormat != "" {
+		t.Errorf("Export modified the search")
+	}
+
+	records, err := client.ExportCSV(context.Background(), search)
+	if err != nil || len(records) != 1 {
+		t.Fatalf("ExportCSV returned (%v, %v)", records, err)
+	}
+	if records[0]["comment"] != "my, comment" || records[0]["attribute_tag"] != "tlp:white" {
+		t.Errorf("ExportCSV returned %v", records[0])
+	}
+
+	hashes, err := client.ExportHashes(context.Background(), search)
+	want := []string{"68b329da9893e34099c7d8ad5cb9c940", "d41d8cd98f00b204e9800998ecf8427e"}
+	if err != nil || !reflect.DeepEqual(hashes, want) {
+		t.Errorf("ExportHashes returned (%v, %v), want %v", hashes, err, want)
+	}
+
+	buf.Reset()
+	if _, err = client.Export(context.Background(), "attributes", ExportText, nil, &buf); err != nil || buf.Len() == 0 {
+		t.Errorf("Export of a nil search returned %v", err)
+	}
+}
+
+func Test_SearchBuilder(t *testing.T) {
+	setup()
+
+	query, err := NewSearchBuilder().
+		Tags(Or("tlp:white", "tlp:green").Not("osint")).
+		Types(Or("md5", "sha1")).
+		Published(false).
+		Since(36 * time.Hour).
+		Build()
+	if err != nil {
+		t.Fatalf("Build returned %s", err)
+	}
+
+	mux.HandleFunc("/events/restSearch",
+		func(w http.ResponseWriter, r *http.Request) {
+			var got map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json query: %s", err)
+			}
+			want := map[string]interface{}{
+				"tags": map[string]interface{}{
+					"OR":  []interface{}{"tlp:white", "tlp:green"},
+					"NOT": []interface{}{"osint"},
+				},
+				"type":      []interface{}{"md5", "sha1"},
+				"published": false,
+				"timestamp": "36h",
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Query is %v, want %v", got, want)
+			}
+			fmt.Fprint(w, `{"response": [{"Event": {"id": "1"}}]}`)
+		})
+
+	events, err := client.SearchEventsQuery(query)
+	if err != nil || len(events.Response) != 1 {
+		t.Errorf("SearchEventsQuery returned (%v, %v)", events, err)
+	}
+
+	now := time.Now()
+	for name, b := range map[string]*SearchBuilder{
+		"Since and Between": NewSearchBuilder().Since(time.Hour).Between(now.Add(-time.Hour), now),
+		"reversed Between":  NewSearchBuilder().Between(now, now.Add(-time.Hour)),
+		"excluded term":     NewSearchBuilder().Tags(Or("a").Not("a")),
+		"empty terms":       NewSearchBuilder().Values(Terms{}),
+		"Last unpublished":  NewSearchBuilder().Last(24 * time.Hour).Published(false),
+		"invalid page":      NewSearchBuilder().Page(0),
+	} {
+		if _, err := b.Build(); err == nil {
+			t.Errorf("%s: Build did not fail", name)
+		}
+	}
+}
+
+func Test_SearchOmitsZeroFields(t *testing.T) {
+	data, err := json.Marshal(&Search{Value: "1.2.3.4"})
+	if err != nil || string(data) != `{"value":"1.2.3.4"}` {
+		t.Errorf("Marshal returned (%s, %v)", data, err)
+	}
+
+	var s Search
+	s.ModelOverrides.Lifetime = 30
+	data, err = json.Marshal(s)
+	if err != nil || string(data) != `{"modelOverrides":{"lifetime":30}}` {
+		t.Errorf("Marshal returned (%s, %v)", data, err)
+	}
+}
+
+func Test_SearchObjects(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/objects/restSearch",
+		func(w http.ResponseWriter, r *http.Request) {
+			var got map[string]interface{}
+			if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+				t.Errorf("Cannot decode json SearchQuery request: %s", err)
+			}
+			want := map[string]interface{}{
+				"object_name": "file",
+				"value":       "68b329da9893e34099c7d8ad5cb9c940",
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Search is %v, want %v", got, want)
+			}
+			fmt.Fprint(w, `{"response": [{"Object": {"id": "12", "name": "file", "event_id": "6871",
+				"Attribute": [{"id": "101", "object_relation": "md5", "type": "md5", "value": "68b329da9893e34099c7d8ad5cb9c940"}],
+				"ObjectReference": [{"id": "3", "relationship_type": "drops", "referenced_uuid": "5c8bd8a0-cf48-4fbb-b38b-4a3d0a3ac101"}]}}]}`)
+		})
+
+	objects, err := client.SearchObjects(&Search{
+		ObjectName: "file",
+		Value:      "68b329da9893e34099c7d8ad5cb9c940",
+	})
+	if err != nil || len(objects) != 1 {
+		t.Fatalf("SearchObjects returned (%v, %v)", objects, err)
+	}
+	object := objects[0]
+	if object.ID != "12" || len(object.Attribute) != 1 || object.Attribute[0].ObjectRelation != "md5" ||
+		len(object.ObjectReference) != 1 || object.ObjectReference[0].RelationshipType != "drops" {
+		t.Errorf("SearchObjects returned %+v", object)
+	}
+}
+
+func Test_Tags(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/tags/index", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `{"Tag": [{"id": "1", "name": "tlp:white", "colour": "#ffffff", "exportable": true}, {"id": "2", "name": "osint", "hide_tag": false}]}`)
+	})
+	mux.HandleFunc("/tags/view/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"id": "1", "name": "tlp:white", "colour": "#ffffff", "numerical_value": null}`)
+	})
+	mux.HandleFunc("/tags/search/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/tags/search/%tlp%" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		fmt.Fprint(w, `[{"Tag": {"id": "1", "name": "tlp:white"}, "Taxonomy": {"id": "3", "namespace": "tlp"}}]`)
+	})
+	mux.HandleFunc("/tags/add", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		var got map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&got)
+		if _, ok := got["id"]; ok || got["name"] != "campaign:x" || got["colour"] != "#ff0000" {
+			t.Errorf("Unexpected tag %v", got)
+		}
+		fmt.Fprint(w, `{"Tag": {"id": "7", "name": "campaign:x", "colour": "#ff0000", "exportable": true}}`)
+	})
+	mux.HandleFunc("/tags/edit/7", func(w http.ResponseWriter, r *http.Request) {
+		var got Tag
+		json.NewDecoder(r.Body).Decode(&got)
+		if got.NumericalValue != "80" || !got.HideTag {
+			t.Errorf("Unexpected tag %+v", got)
+		}
+		fmt.Fprint(w, `{"Tag": {"id": "7", "name": "campaign:x", "hide_tag": true, "numerical_value": 80}}`)
+	})
+	mux.HandleFunc("/tags/delete/7", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name": "Tag deleted.", "message": "Tag deleted.", "url": "/tags/delete/7"}`)
+	})
+	mux.HandleFunc("/tags/attachTagToObject", func(w http.ResponseWriter, r *http.Request) {
+		var got map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&got)
+		if got["tag"] == "unknown" {
+			fmt.Fprint(w, `{"errors": "Invalid Tag. This should never happen."}`)
+			return
+		}
+		if got["uuid"] != "5c8bd8a0-cf48-4fbb-b38b-4a3d0a3ac101" || got["local"] != true {
+			t.Errorf("Unexpected request %v", got)
+		}
+		fmt.Fprint(w, `{"saved": true, "success": "Local tag campaign:x(7) successfully attached to Attribute(12).", "check_publish": true}`)
+	})
+	mux.HandleFunc("/tags/removeTagFromObject", func(w http.ResponseWriter, r *http.Request) {
+		var got map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&got)
+		if _, ok := got["local"]; ok {
+			t.Errorf("Unexpected request %v", got)
+		}
+		fmt.Fprint(w, `{"saved": true, "success": "Tag removed.", "check_publish": true}`)
+	})
+
+	tags, err := client.ListTags()
+	if err != nil || len(tags) != 2 || !tags[0].Exportable || tags[1].Name != "osint" {
+		t.Errorf("ListTags returned (%+v, %v)", tags, err)
+	}
+	tag, err := client.GetTag("1")
+	if err != nil || tag.Name != "tlp:white" {
+		t.Errorf("GetTag returned (%+v, %v)", tag, err)
+	}
+	tags, err = client.SearchTags("tlp", false)
+	if err != nil || len(tags) != 1 || tags[0].ID != "1" {
+		t.Errorf("SearchTags returned (%+v, %v)", tags, err)
+	}
+
+	tag, err = client.AddTag(Tag{Name: "campaign:x", Colour: "#ff0000", Exportable: true})
+	if err != nil || tag.ID != "7" {
+		t.Fatalf("AddTag returned (%+v, %v)", tag, err)
+	}
+	tag.HideTag = true
+	tag.NumericalValue = "80"
+	if tag, err = client.UpdateTag(tag); err != nil || tag.NumericalValue != "80" {
+		t.Errorf("UpdateTag returned (%+v, %v)", tag, err)
+	}
+	if _, err = client.UpdateTag(Tag{Name: "no id"}); err == nil {
+		t.Errorf("UpdateTag accepted a tag without ID")
+	}
+
+	resp, err := client.AttachTag("5c8bd8a0-cf48-4fbb-b38b-4a3d0a3ac101", "campaign:x", true)
+	if err != nil || !resp.Saved || resp.Success == "" {
+		t.Errorf("AttachTag returned (%+v, %v)", resp, err)
+	}
+	if _, err = client.AttachTag("5c8bd8a0-cf48-4fbb-b38b-4a3d0a3ac101", "unknown", false); err == nil {
+		t.Errorf("AttachTag did not fail on an unknown tag")
+	}
+	if resp, err = client.DetachTag("5c8bd8a0-cf48-4fbb-b38b-4a3d0a3ac101", "campaign:x"); err != nil || !resp.Saved {
+		t.Errorf("DetachTag returned (%+v, %v)", resp, err)
+	}
+	if resp, err = client.DeleteTag("7"); err != nil || resp.Name != "Tag deleted." {
+		t.Errorf("DeleteTag returned (%+v, %v)", resp, err)
+	}
+}
+
+func Test_MachineTag(t *testing.T) {
+	for name, want := range map[string]MachineTag{
+		`tlp:amber`:                                 {"tlp", "amber", ""},
+		`admiralty-scale:source-reliability="b"`:    {"admiralty-scale", "source-reliability", "b"},
+		`misp-galaxy:threat-actor="APT 29"`:         {"misp-galaxy", "threat-actor", "APT 29"},
+		`misp-galaxy:tool="Cobalt "Beacon" Strike"`: {"misp-galaxy", "tool", `Cobalt "Beacon" Strike`},
+	} {
+		got, err := ParseMachineTag(name)
+		if err != nil || got != want {
+			t.Errorf("ParseMachineTag(%s) returned (%#v, %v), want %#v", name, got, err, want)
+		}
+		if got.String() != name {
+			t.Errorf("%#v renders as %s, want %s", got, got.String(), name)
+		}
+	}
+	for _, name := range []string{"osint", ":amber", "tlp:", `ns:pred=b`, `ns:pred=""`} {
+		if _, err := ParseMachineTag(name); err == nil {
+			t.Errorf("ParseMachineTag(%s) did not fail", name)
+		}
+	}
+
+	mt, _ := ParseMachineTag(`misp-galaxy:threat-actor="APT 29"`)
+	if !mt.IsGalaxy() || TLPRed.Tag().IsGalaxy() {
+		t.Errorf("IsGalaxy is wrong")
+	}
+
+	event := Event{Tag: []Tag{{Name: "tlp:green"}, {Name: "TLP:AMBER"}, {Name: `tlp:red="x"`}, {Name: "osint"}}}
+	if tlp, ok := event.TLP(); !ok || tlp != TLPAmber {
+		t.Errorf("TLP returned (%s, %v), want amber", tlp, ok)
+	}
+	if tlp, ok := (Event{Tag: []Tag{{Name: "osint"}}}).TLP(); ok {
+		t.Errorf("TLP returned %s for an event without TLP", tlp)
+	}
+}
+
+func Test_TaxonomyRegistry(t *testing.T) {
+	registry := NewTaxonomyRegistry()
+	if err := registry.LoadDir("testdata/taxonomies"); err != nil {
+		t.Fatalf("LoadDir returned an error: %s", err)
+	}
+	if namespaces := registry.Namespaces(); !reflect.DeepEqual(namespaces, []string{"admiralty-scale", "tlp"}) {
+		t.Errorf("Namespaces returned %v", namespaces)
+	}
+
+	valid := []string{
+		"tlp:amber",
+		`admiralty-scale:source-reliability="b"`,
+		`admiralty-scale:information-credibility="2"`,
+		"osint",
+		`misp-galaxy:threat-actor="APT 29"`,
+	}
+	if err := registry.Validate(valid); err != nil {
+		t.Errorf("Validate returned %s", err)
+	}
+
+	err := registry.Validate([]string{
+		"tlp:amber",
+		"tlp:green",
+		"tlp:purple",
+		`tlp:red="x"`,
+		`admiralty-scale:source-reliability="a"`,
+		`admiralty-scale:source-reliability="b"`,
+		`admiralty-scale:source-reliability="z"`,
+		"admiralty-scale:information-credibility",
+	})
+	verr, ok := err.(*TagValidationError)
+	if !ok || len(verr.Problems) != 6 {
+		t.Fatalf("Validate returned %v", err)
+	}
+
+	existing := []Tag{{Name: "tlp:green"}}
+	if err := registry.CanAttach(existing, "tlp:green"); err != nil {
+		t.Errorf("CanAttach refused a tag already set: %s", err)
+	}
+	if err := registry.CanAttach(existing, "tlp:red"); err == nil {
+		t.Errorf("CanAttach accepted a second TLP")
+	}
+}
+
+func Test_Taxonomies(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/taxonomies/index", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `[{"Taxonomy": {"id": "3", "namespace": "tlp", "version": "10", "enabled": true, "exclusive": true, "required": false}, "total_count": 4, "current_count": 4}]`)
+	})
+	mux.HandleFunc("/taxonomies/view/3", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"Taxonomy": {"id": "3", "namespace": "tlp", "version": "10", "enabled": true, "exclusive": true}, "entries": [{"tag": "tlp:red", "expanded": "(TLP:RED) ...", "exclusive_predicate": false, "existing_tag": {"Tag": {"id": "4"}}}]}`)
+	})
+	mux.HandleFunc("/taxonomies/disable/3", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		fmt.Fprint(w, `{"name": "Taxonomy disabled", "message": "Taxonomy disabled", "url": "/taxonomies/disable/3"}`)
+	})
+
+	taxonomies, err := client.ListTaxonomies()
+	if err != nil || len(taxonomies) != 1 || !taxonomies[0].Enabled || taxonomies[0].Version != 10 {
+		t.Errorf("ListTaxonomies returned (%+v, %v)", taxonomies, err)
+	}
+	taxonomy, err := client.GetTaxonomy("3")
+	if err != nil || !taxonomy.Exclusive || len(taxonomy.Entries) != 1 || taxonomy.Entries[0].Tag != "tlp:red" {
+		t.Errorf("GetTaxonomy returned (%+v, %v)", taxonomy, err)
+	}
+	if resp, err := client.DisableTaxonomy("3"); err != nil || resp.Name != "Taxonomy disabled" {
+		t.Errorf("DisableTaxonomy returned (%+v, %v)", resp, err)
+	}
+}
+
+func Test_Galaxies(t *testing.T) {
+	setup()
+
+	var event Event
+	err := json.Unmarshal([]byte(`{"id": "1", "Galaxy": [{"id": "3", "uuid": "c4e851fa-775f-11e7-8163-b774922098cd", "name": "Attack Pattern", "type": "mitre-attack-pattern", "namespace": "mitre-attack",
+		"kill_chain_order": {"mitre-attack": ["reconnaissance", "initial-access"], "mitre-mobile-attack": ["initial-access"]},
+		"GalaxyCluster": [{"id": "42", "uuid": "a62a8db3-f23a-4d8f-afd6-9dbc77e7813b", "type": "mitre-attack-pattern", "value": "Phishing - T1566",
+			"tag_name": "misp-galaxy:mitre-attack-pattern=\"Phishing - T1566\"", "galaxy_id": "3", "local": false,
+			"meta": {"external_id": ["T1566"], "kill_chain": ["mitre-attack:initial-access"], "mitre_platforms": "Linux"}}]},
+		{"id": "4", "name": "Threat Actor", "type": "threat-actor", "kill_chain_order": []}]}`), &event)
+	if err != nil {
+		t.Fatalf("Cannot decode event: %s", err)
+	}
+	galaxy := event.Galaxy[0]
+	if len(galaxy.KillChainOrder["mitre-attack"]) != 2 || len(galaxy.GalaxyCluster) != 1 {
+		t.Errorf("Galaxy decoded as %+v", galaxy)
+	}
+	cluster := galaxy.GalaxyCluster[0]
+	if cluster.Meta["external_id"][0] != "T1566" || cluster.Meta["mitre_platforms"][0] != "Linux" || cluster.MachineTag().String() != cluster.TagName {
+		t.Errorf("GalaxyCluster decoded as %+v", cluster)
+	}
+	if event.Galaxy[1].KillChainOrder != nil {
+		t.Errorf("Empty kill_chain_order decoded as %v", event.Galaxy[1].KillChainOrder)
+	}
+
+	mux.HandleFunc("/galaxies/index", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `[{"Galaxy": {"id": "4", "name": "Threat Actor", "type": "threat-actor", "enabled": true, "kill_chain_order": null}}]`)
+	})
+	mux.HandleFunc("/galaxy_clusters/view/42", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"GalaxyCluster": {"id": "42", "value": "Phishing - T1566", "GalaxyElement": [{"key": "external_id", "value": "T1566"}],
+			"GalaxyClusterRelation": [{"referenced_galaxy_cluster_uuid": "2e34237d-8574-43f6-aace-ae2915de8597", "referenced_galaxy_cluster_type": "subtechnique-of"}]}}`)
+	})
+	mux.HandleFunc("/galaxy_clusters/index/4", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		var got clusterSearchRequest
+		json.NewDecoder(r.Body).Decode(&got)
+		if got.Context != ClusterContextCustom || got.SearchAll != "APT" {
+			t.Errorf("Unexpected search %+v", got)
+		}
+		fmt.Fprint(w, `[{"GalaxyCluster": {"id": "51", "value": "APT X", "default": false}}]`)
+	})
+	mux.HandleFunc("/galaxies/attachCluster/12/attribute/local:1", func(w http.ResponseWriter, r *http.Request) {
+		var got attachClusterRequest
+		json.NewDecoder(r.Body).Decode(&got)
+		if got.Galaxy.TargetID != "51" {
+			t.Errorf("Unexpected request %+v", got)
+		}
+		fmt.Fprint(w, `{"saved": true, "success": "Cluster attached.", "check_publish": true}`)
+	})
+	mux.HandleFunc("/galaxy_clusters/add/4", func(w http.ResponseWriter, r *http.Request) {
+		var got map[string]map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&got)
+		if _, ok := got["GalaxyCluster"]["id"]; ok || got["GalaxyCluster"]["value"] != "APT Y" {
+			t.Errorf("Unexpected cluster %v", got)
+		}
+		fmt.Fprint(w, `{"GalaxyCluster": {"id": "52", "value": "APT Y", "GalaxyElement": [{"id": "9", "key": "synonyms", "value": "Y Team"}]}}`)
+	})
+	mux.HandleFunc("/galaxy_clusters/delete/52/1", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name": "Galaxy cluster deleted", "message": "Galaxy cluster deleted", "url": "/galaxy_clusters/delete/52"}`)
+	})
+
+	galaxies, err := client.ListGalaxies()
+	if err != nil || len(galaxies) != 1 || !galaxies[0].Enabled {
+		t.Errorf("ListGalaxies returned (%+v, %v)", galaxies, err)
+	}
+	cluster, err = client.GetGalaxyCluster("42")
+	if err != nil || len(cluster.GalaxyElement) != 1 || cluster.GalaxyClusterRelation[0].ReferencedGalaxyClusterType != "subtechnique-of" {
+		t.Errorf("GetGalaxyCluster returned (%+v, %v)", cluster, err)
+	}
+	clusters, err := client.SearchGalaxyClusters("4", ClusterContextCustom, "APT")
+	if err != nil || len(clusters) != 1 || clusters[0].ID != "51" {
+		t.Errorf("SearchGalaxyClusters returned (%+v, %v)", clusters, err)
+	}
+	if resp, err := client.AttachCluster(ClusterTargetAttribute, "12", "51", true); err != nil || !resp.Saved {
+		t.Errorf("AttachCluster returned (%+v, %v)", resp, err)
+	}
+	cluster, err = client.AddGalaxyCluster("4", GalaxyCluster{
+		Value:         "APT Y",
+		GalaxyElement: []GalaxyElement{{Key: "synonyms", Value: "Y Team"}},
+	})
+	if err != nil || cluster.ID != "52" {
+		t.Errorf("AddGalaxyCluster returned (%+v, %v)", cluster, err)
+	}
+	if _, err = client.UpdateGalaxyCluster(GalaxyCluster{Value: "no id"}); err == nil {
+		t.Errorf("UpdateGalaxyCluster accepted a cluster without ID")
+	}
+	if resp, err := client.DeleteGalaxyCluster("52", true); err != nil || resp.Name == "" {
+		t.Errorf("DeleteGalaxyCluster returned (%+v, %v)", resp, err)
+	}
+}
+
+func Test_Sightings(t *testing.T) {
+	setup()
+
+	seenAt := time.Unix(1700000000, 0)
+	var requests []map[string]interface{}
+	mux.HandleFunc("/sightings/add/", func(w http.ResponseWriter, r *http.Request) {
+		var got Request
+		json.NewDecoder(r.Body).Decode(&got)
+		req := got.Request.(map[string]interface{})
+		if _, ok := req["date_sighting"]; ok {
+			t.Errorf("date_sighting sent: %v", req)
+		}
+		requests = append(requests, req)
+		fmt.Fprint(w, `{"name": "Sightings added", "message": "Sightings added", "url": "/sightings/add"}`)
+	})
+	mux.HandleFunc("/sightings/listSightings/12/attribute", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		fmt.Fprint(w, `[{"Sighting": {"id": "5", "attribute_id": "12", "event_id": "6871", "org_id": "1", "date_sighting": "1700000000", "uuid": "5e8dc5a0-1f6c-4a9a-9a9f-4a3d0a3ac101", "source": "edr", "type": "1"}}]`)
+	})
+	mux.HandleFunc("/sightings/restSearch/event", func(w http.ResponseWriter, r *http.Request) {
+		var got map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&got)
+		want := map[string]interface{}{"id": "6871", "type": "1", "last": "7d", "includeAttribute": true}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Search is %v, want %v", got, want)
+		}
+		fmt.Fprint(w, `[{"Sighting": {"id": "5", "type": 1, "Attribute": {"id": "12", "value": "10.0.0.1"}}}]`)
+	})
+	mux.HandleFunc("/sightings/delete/5", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"name": "Sighting successfully deleted.", "message": "Sighting successfully deleted.", "url": "/sightings/delete/5"}`)
+	})
+
+	responses, err := client.AddSightings([]Sighting{
+		{Value: "10.0.0.1", Source: "edr"},
+		{Value: "10.0.0.2", Source: "edr"},
+		{Value: "10.0.0.1", Source: "edr"},
+		{Values: []string{"10.0.0.3", "10.0.0.2"}, Source: "edr"},
+		{Value: "10.0.0.1", Source: "edr", Type: SightingTypeFalsePositive, DateSighting: UnixTime{seenAt}},
+		{UUID: "5c8bd8a0-cf48-4fbb-b38b-4a3d0a3ac101"},
+		{Value: "10.0.0.1", Source: "edr", OrgID: "2"},
+	})
+	if err != nil || len(responses) != 4 || len(requests) != 4 {
+		t.Fatalf("AddSightings returned (%v, %v) after %d requests", responses, err, len(requests))
+	}
+	if requests[0]["uuid"] != "5c8bd8a0-cf48-4fbb-b38b-4a3d0a3ac101" {
+		t.Errorf("Unexpected request %v", requests[0])
+	}
+	if values := requests[1]["values"]; !reflect.DeepEqual(values, []interface{}{"10.0.0.1", "10.0.0.2", "10.0.0.3"}) {
+		t.Errorf("Coalesced values are %v", values)
+	}
+	if requests[2]["type"] != "1" || requests[2]["timestamp"] != float64(1700000000) {
+		t.Errorf("Unexpected request %v", requests[2])
+	}
+	if _, ok := requests[1]["org_id"]; ok {
+		t.Errorf("Unexpected org_id in %v", requests[1])
+	}
+	if requests[3]["org_id"] != "2" || !reflect.DeepEqual(requests[3]["values"], []interface{}{"10.0.0.1"}) {
+		t.Errorf("Unexpected request %v", requests[3])
+	}
+
+	sightings, err := client.ListSightings(SightingContextAttribute, "12")
+	if err != nil || len(sightings) != 1 || sightings[0].Type != SightingTypeFalsePositive || !sightings[0].DateSighting.Equal(seenAt) {
+		t.Errorf("ListSightings returned (%+v, %v)", sightings, err)
+	}
+	sightings, err = client.SearchSightings(&SightingSearch{
+		Context:          SightingContextEvent,
+		ID:               "6871",
+		Type:             SightingTypeFalsePositive,
+		Last:             "7d",
+		IncludeAttribute: true,
+	})
+	if err != nil || len(sightings) != 1 || sightings[0].Attribute == nil || sightings[0].Attribute.Value != "10.0.0.1" {
+		t.Errorf("SearchSightings returned (%+v, %v)", sightings, err)
+	}
+	if resp, err := client.DeleteSighting("5"); err != nil || resp.Name == "" {
+		t.Errorf("DeleteSighting returned (%+v, %v)", resp, err)
+	}
+}
+
+func Test_SightingBatcher(t *testing.T) {
+	setup()
+
+	var (
+		mu      sync.Mutex
+		calls   int
+		batches [][]string
+	)
+	mux.HandleFunc("/sightings/add/", func(w http.ResponseWriter, r *http.Request) {
+		var got struct {
+			Request Sighting `json:"request"`
+		}
+		json.NewDecoder(r.Body).Decode(&got)
+
+		mu.Lock()
+		defer mu.Unlock()
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		if got.Request.Source == "unknown" {
+			w.WriteHeader(http.StatusForbidden)
+			fmt.Fprint(w, `{"name": "Could not add Sighting", "message": "Could not add Sighting", "errors": "No valid attributes found that match the criteria."}`)
+			return
+		}
+		batches = append(batches, got.Request.Values)
+		fmt.Fprint(w, `{"name": "Sightings added", "message": "Sightings added", "url": "/sightings/add"}`)
+	})
+
+	b := NewSightingBatcher(client, 3, time.Hour)
+	for _, value := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.1", "10.0.0.3"} {
+		if err := b.AddValue(value, SightingTypeSighting, "edr"); err != nil {
+			t.Fatalf("AddValue returned %s", err)
+		}
+	}
+
+	// the full batch is sent again after the 503, wait for that flush to end
+	deadline := time.Now().Add(5 * time.Second)
+	for (b.Pending() != 0 || b.LastError() != nil) && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if b.Pending() != 0 || b.LastError() != nil {
+		t.Errorf("Pending is %d, LastError is %v", b.Pending(), b.LastError())
+	}
+
+	b.AddValue("10.0.0.4", SightingTypeSighting, "edr")
+	b.AddValue("10.0.0.5", SightingTypeSighting, "unknown")
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := b.Close(ctx); err != nil {
+		t.Errorf("Close returned %s", err)
+	}
+	if !IsForbidden(b.LastError()) {
+		t.Errorf("LastError is %v, want the 403 of the dropped batch", b.LastError())
+	}
+	if err := b.AddValue("10.0.0.6", SightingTypeSighting, "edr"); err != ErrBatcherClosed {
+		t.Errorf("AddValue after Close returned %v", err)
+	}
+
+	want := [][]string{{"10.0.0.1", "10.0.0.2", "10.0.0.3"}, {"10.0.0.4"}}
+	mu.Lock()
+	defer mu.Unlock()
+	if !reflect.DeepEqual(batches, want) {
+		t.Errorf("Sent batches %v, want %v", batches, want)
+	}
+}
+
+func Test_Proposals(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/shadow_attributes/add/6871", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		var got map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&got)
+		if _, ok := got["id"]; ok || got["value"] != "10.0.0.1" {
+			t.Errorf("Unexpected proposal %v", got)
+		}
+		fmt.Fprint(w, `{"ShadowAttribute": {"id": "3", "event_id": "6871", "old_id": "0", "type": "ip-dst", "value": "10.0.0.1", "org_id": "2", "email": "analyst@partner.test"}}`)
+	})
+	mux.HandleFunc("/shadow_attributes/edit/12", func(w http.ResponseWriter, r *http.Request) {
+		var got map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&got)
+		if _, ok := got["uuid"]; ok || got["comment"] != "typo" {
+			t.Errorf("Unexpected proposal %v", got)
+		}
+		fmt.Fprint(w, `{"ShadowAttribute": {"id": "4", "old_id": "12", "value": "10.0.0.2", "comment": "typo"}}`)
+	})
+	mux.HandleFunc("/shadow_attributes/delete/12", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"saved": true, "success": "Proposal to delete attribute saved.", "message": "Proposal to delete attribute saved."}`)
+	})
+	mux.HandleFunc("/shadow_attributes/index/6871", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "GET")
+		fmt.Fprint(w, `[{"ShadowAttribute": {"id": "3", "old_id": "0"}}, {"id": "5", "old_id": "12", "proposal_to_delete": true}]`)
+	})
+	mux.HandleFunc("/shadow_attributes/accept/3", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"saved": true, "success": "Proposal accepted."}`)
+	})
+	mux.HandleFunc("/shadow_attributes/discard/5", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		fmt.Fprint(w, `{"name": "Invalid proposal.", "message": "Invalid proposal.", "url": "/shadow_attributes/discard/5"}`)
+	})
+
+	attr := NewAttribute()
+	attr.Type = "ip-dst"
+	attr.Value = "10.0.0.1"
+	proposal, err := client.ProposeAttribute("6871", attr)
+	if err != nil || proposal.ID != "3" || proposal.OldID != "0" || proposal.Email == "" {
+		t.Errorf("ProposeAttribute returned (%+v, %v)", proposal, err)
+	}
+	attr.Value = "10.0.0.2"
+	attr.Comment = "typo"
+	if proposal, err = client.ProposeEdit("12", attr); err != nil || proposal.OldID != "12" {
+		t.Errorf("ProposeEdit returned (%+v, %v)", proposal, err)
+	}
+	if resp, err := client.ProposeDelete("12"); err != nil || !resp.Saved {
+		t.Errorf("ProposeDelete returned (%+v, %v)", resp, err)
+	}
+
+	proposals, err := client.ListProposals("6871")
+	if err != nil || len(proposals) != 2 || proposals[0].ID != "3" || !proposals[1].ProposalToDelete {
+		t.Errorf("ListProposals returned (%+v, %v)", proposals, err)
+	}
+	if resp, err := client.AcceptProposal("3"); err != nil || !resp.Saved {
+		t.Errorf("AcceptProposal returned (%+v, %v)", resp, err)
+	}
+	if _, err := client.DiscardProposal("5"); !IsNotFound(err) {
+		t.Errorf("DiscardProposal returned %v, want a 404", err)
+	}
+}
+
+func Test_EventReports(t *testing.T) {
+	setup()
+
+	mux.HandleFunc("/event_reports/add/6871", func(w http.ResponseWriter, r *http.Request) {
+		testMethod(t, r, "POST")
+		var got map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&got)
+		if got["name"] != "Narrative" || got["distribution"] != "5" {
+			t.Errorf("Unexpected report %v", got)
+		}
+		fmt.Fprintf(w, `{"EventReport": {"id": "2", "uuid": %q, "event_id": "6871", "name": "Narrative", "content": %q, "distribution": "5", "timestamp": "1700000000", "deleted": false}}`,
+			got["uuid"], got["content"])
+	})
+	mux.HandleFunc("/event_reports/index/event_id:6871", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `[{"EventReport": {"id": "2", "name": "Narrative"}}]`)
+	})
+	mux.HandleFunc("/event_reports/edit/2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"EventReport": {"id": "2", "name": "Narrative v2"}}`)
+	})
+	mux.HandleFunc("/event_reports/delete/2", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"saved": true, "success": true, "name": "Event Report 2 soft deleted", "message": "Event Report 2 soft deleted", "url": "/event_reports/delete/2"}`)
+	})
+
+	content := "The dropper " + ObjectMarkdown("5c8bd8a0-cf48-4fbb-b38b-4a3d0a3ac101") +
+		" beacons to " + AttributeMarkdown("5c8bd8a0-1a2c-4a3d-9f2b-4a3d0a3ac102") +
+		" and " + AttributeMarkdown("5c8bd8a0-0000-0000-0000-000000000000") + "."
+	report, err := client.AddEventReport("6871", NewEventReport("Narrative", content))
+	if err != nil || report.ID != "2" || report.Content != content || report.Timestamp.Unix() != 1700000000 {
+		t.Fatalf("AddEventReport returned (%+v, %v)", report, err)
+	}
+
+	refs := ParseReportReferences(report.Content)
+	want := []ReportReference{
+		{ReferenceObject, "5c8bd8a0-cf48-4fbb-b38b-4a3d0a3ac101"},
+		{ReferenceAttribute, "5c8bd8a0-1a2c-4a3d-9f2b-4a3d0a3ac102"},
+		{ReferenceAttribute, "5c8bd8a0-0000-0000-0000-000000000000"},
+	}
+	if !reflect.DeepEqual(refs, want) {
+		t.Errorf("ParseReportReferences returned %v, want %v", refs, want)
+	}
+	event := Event{
+		Object: []Object{{UUID: "5c8bd8a0-cf48-4fbb-b38b-4a3d0a3ac101", Name: "file",
+			Attribute: []Attribute{{UUID: "5c8bd8a0-1a2c-4a3d-9f2b-4a3d0a3ac102", Value: "10.0.0.1"}}}},
+	}
+	expanded := ExpandReportReferences(report.Content, event)
+	if expanded != "The dropper **file** beacons to `10.0.0.1` and @[attribute](5c8bd8a0-0000-0000-0000-000000000000)." {
+		t.Errorf("ExpandReportReferences returned %s", expanded)
+	}
+
+	reports, err := client.ListEventReports("6871")
+	if err != nil || len(reports) != 1 {
+		t.Errorf("ListEventReports returned (%+v, %v)", reports, err)
+	}
+	report.Name = "Narrative v2"
+	if report, err = client.UpdateEventReport(report); err != nil || report.Name != "Narrative v2" {
+		t.Errorf("UpdateEventReport returned (%+v, %v)", report, err)
+	}
+	if resp, err := client.DeleteEventReport("2", false); err != nil || !resp.Saved {
+		t.Errorf("DeleteEventReport returned (%+v, %v)", resp, err)
+	}
+}
@@ -0,0 +1,222 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// UUIDs of the misp-objects templates most commonly built by hand
+const (
+	FileTemplateUUID     = "688c46fb-5edb-40a3-8273-1af7923e2215"
+	DomainIPTemplateUUID = "43b3b146-77eb-4931-b4cc-b66c60f28734"
+	EmailTemplateUUID    = "a0c666e0-fc65-4be8-b48f-3423d788b552"
+)
+
+// NewObject returns an empty object following the given template. The
+// template version is left empty so MISP picks the one it knows.
+func NewObject(name, metaCategory, templateUUID string) Object {
+	return Object{
+		Name:         name,
+		MetaCategory: metaCategory,
+		TemplateUUID: templateUUID,
+		UUID:         uuid.NewString(),
+		Timestamp:    NewUnixTime(time.Now()),
+		Distribution: DistributionInheritEvent,
+		Attribute:    []Attribute{},
+	}
+}
+
+// NewFileObject returns an empty "file" object
+func NewFileObject() Object {
+	return NewObject("file", "file", FileTemplateUUID)
+}
+
+// NewDomainIPObject returns an empty "domain-ip" object
+func NewDomainIPObject() Object {
+	return NewObject("domain-ip", "network", DomainIPTemplateUUID)
+}
+
+// NewEmailObject returns an empty "email" object
+func NewEmailObject() Object {
+	return NewObject("email", "network", EmailTemplateUUID)
+}
+
+// AddAttribute appends an attribute for the given object relation and
+// returns it so it can be tuned further, until the next call
+func (o *Object) AddAttribute(relation, attrType, value string) *Attribute {
+	attr := NewAttribute()
+	attr.ObjectRelation = relation
+	attr.Type = attrType
+	attr.Value = value
+	attr.Distribution = DistributionInheritEvent
+	o.Attribute = append(o.Attribute, attr)
+	return &o.Attribute[len(o.Attribute)-1]
+}
+
+// AddReference appends a reference from the object to the object or
+// attribute identified by referencedUUID
+func (o *Object) AddReference(referencedUUID, relationship string) *ObjectReference {
+	o.ObjectReference = append(o.ObjectReference, ObjectReference{
+		UUID:             uuid.NewString(),
+		Timestamp:        NewUnixTime(time.Now()),
+		SourceUUID:       o.UUID,
+		ObjectUUID:       o.UUID,
+		ReferencedUUID:   referencedUUID,
+		RelationshipType: relationship,
+	})
+	return &o.ObjectReference[len(o.ObjectReference)-1]
+}
+
+// Add an object to an event
+func (client *Client) AddObject(eventID string, obj Object) (Object, error) {
+	return client.AddObjectContext(context.Background(), eventID, obj)
+}
+
+// AddObjectContext is like AddObject but honors ctx
+func (client *Client) AddObjectContext(ctx context.Context, eventID string, obj Object) (Object, error) {
+	path := "/objects/add/" + eventID
+	if obj.TemplateVersion == "" && obj.TemplateUUID != "" {
+		// let MISP fill the template details from its own copy
+		path += "/" + obj.TemplateUUID
+	}
+
+	resp, err := client.PostContext(ctx, path, obj)
+	if err != nil {
+		return Object{}, err
+	}
+	return readObject(resp)
+}
+
+// Get an object by ID or UUID
+func (client *Client) GetObject(id string) (Object, error) {
+	return client.GetObjectContext(context.Background(), id)
+}
+
+// GetObjectContext is like GetObject but honors ctx
+func (client *Client) GetObjectContext(ctx context.Context, id string) (Object, error) {
+	resp, err := client.GetContext(ctx, "/objects/view/"+id, nil)
+	if err != nil {
+		return Object{}, err
+	}
+	return readObject(resp)
+}
+
+// UpdateObject edits an existing object, identified by its ID or else its
+// UUID, along its attributes. The timestamps are left for MISP to set, as it
+// skips what is not newer than its own copy.
+func (client *Client) UpdateObject(obj Object) (Object, error) {
+	return client.UpdateObjectContext(context.Background(), obj)
+}
+
+// UpdateObjectContext is like UpdateObject but honors ctx
+func (client *Client) UpdateObjectContext(ctx context.Context, obj Object) (Object, error) {
+	id := string(obj.ID)
+	if id == "" {
+		id = obj.UUID
+	}
+	if id == "" {
+		return Object{}, fmt.Errorf("UpdateObject(): object has no ID nor UUID")
+	}
+
+	data, err := ToMap(obj)
+	if err != nil {
+		return Object{}, err
+	}
+	delete(data, "timestamp")
+	dropAttributeTimestamps(data)
+
+	resp, err := client.PostContext(ctx, "/objects/edit/"+id, data)
+	if err != nil {
+		return Object{}, err
+	}
+	return readObject(resp)
+}
+
+// DeleteObject soft deletes an object, or removes it for good when hard is
+// set
+func (client *Client) DeleteObject(id string, hard bool) (*Response, error) {
+	return client.DeleteObjectContext(context.Background(), id, hard)
+}
+
+// DeleteObjectContext is like DeleteObject but honors ctx
+func (client *Client) DeleteObjectContext(ctx context.Context, id string, hard bool) (*Response, error) {
+	path := "/objects/delete/" + id
+	if hard {
+		path += "/1"
+	}
+	return client.postResponse(ctx, path, nil)
+}
+
+// AddObjectReference creates ref, from the object identified by
+// ref.ObjectUUID (or ref.ObjectID) to ref.ReferencedUUID
+func (client *Client) AddObjectReference(ref ObjectReference) (ObjectReference, error) {
+	return client.AddObjectReferenceContext(context.Background(), ref)
+}
+
+// AddObjectReferenceContext is like AddObjectReference but honors ctx
+func (client *Client) AddObjectReferenceContext(ctx context.Context, ref ObjectReference) (ObjectReference, error) {
+	var result map[string]ObjectReference
+
+	id := ref.ObjectUUID
+	if id == "" {
+		id = string(ref.ObjectID)
+	}
+	if id == "" {
+		return ObjectReference{}, fmt.Errorf("AddObjectReference(): reference has no source object")
+	}
+
+	resp, err := client.PostContext(ctx, "/objectReferences/add/"+id, ref)
+	if err != nil {
+		return ObjectReference{}, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return ObjectReference{}, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+	return result["ObjectReference"], nil
+}
+
+// DeleteObjectReference soft deletes a reference, or removes it for good
+// when hard is set
+func (client *Client) DeleteObjectReference(id string, hard bool) (*Response, error) {
+	return client.DeleteObjectReferenceContext(context.Background(), id, hard)
+}
+
+// DeleteObjectReferenceContext is like DeleteObjectReference but honors ctx
+func (client *Client) DeleteObjectReferenceContext(ctx context.Context, id string, hard bool) (*Response, error) {
+	path := "/objectReferences/delete/" + id
+	if hard {
+		path += "/1"
+	}
+	return client.postResponse(ctx, path, nil)
+}
+
+// readObject decodes a {"Object": {...}} reply and closes its body
+// dropAttributeTimestamps removes the timestamp of the attributes nested in
+// the payload of an edit
+func dropAttributeTimestamps(data map[string]interface{}) {
+	attributes, _ := data["Attribute"].([]interface{})
+	for _, item := range attributes {
+		if attr, ok := item.(map[string]interface{}); ok {
+			delete(attr, "timestamp")
+		}
+	}
+}
+
+func readObject(resp *http.Response) (object Object, err error) {
+	var result map[string]Object
+
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return object, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+	return result["Object"], nil
+}
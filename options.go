@@ -0,0 +1,184 @@
+package misp
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// ClientOption configures a Client created by NewClient
+type ClientOption func(*clientConfig) error
+
+type clientConfig struct {
+	verifyCert   bool
+	userAgent    string
+	httpClient   *http.Client
+	roundTripper http.RoundTripper
+	proxy        *url.URL
+	rootCAs      *x509.CertPool
+	certificates []tls.Certificate
+	timeout      time.Duration
+	retry        *RetryPolicy
+	limiter      *Limiter
+}
+
+// WithHTTPClient makes the Client send every request through c. It cannot be
+// combined with the transport related options.
+func WithHTTPClient(c *http.Client) ClientOption {
+	return func(cfg *clientConfig) error {
+		if c == nil {
+			return fmt.Errorf("WithHTTPClient(): nil http.Client")
+		}
+		cfg.httpClient = c
+		return nil
+	}
+}
+
+// WithTransport makes the Client send every request through rt. It cannot be
+// combined with WithProxy, WithRootCAs or WithClientCertificates.
+func WithTransport(rt http.RoundTripper) ClientOption {
+	return func(cfg *clientConfig) error {
+		if rt == nil {
+			return fmt.Errorf("WithTransport(): nil http.RoundTripper")
+		}
+		cfg.roundTripper = rt
+		return nil
+	}
+}
+
+// WithProxy sends every request through the given HTTP(S) proxy. Credentials
+// for an authenticating proxy go in the URL userinfo.
+func WithProxy(proxyURL string) ClientOption {
+	return func(cfg *clientConfig) error {
+		u, err := url.Parse(proxyURL)
+		if err != nil {
+			return fmt.Errorf("WithProxy(): %s", err)
+		}
+		cfg.proxy = u
+		return nil
+	}
+}
+
+// WithRootCAs verifies the MISP server certificate against pool instead of
+// the system roots
+func WithRootCAs(pool *x509.CertPool) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.rootCAs = pool
+		return nil
+	}
+}
+
+// WithClientCertificates presents certs to the server for mutual TLS
+func WithClientCertificates(certs ...tls.Certificate) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.certificates = append(cfg.certificates, certs...)
+		return nil
+	}
+}
+
+// WithTimeout bounds the total time of a single HTTP exchange, body included
+func WithTimeout(d time.Duration) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.timeout = d
+		return nil
+	}
+}
+
+// WithUserAgent sets the User-Agent header sent on every request
+func WithUserAgent(ua string) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.userAgent = ua
+		return nil
+	}
+}
+
+// WithVerifyCert enables or disables the verification of the server
+// certificate
+func WithVerifyCert(verify bool) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.verifyCert = verify
+		return nil
+	}
+}
+
+// WithRetryPolicy retries failed requests according to p
+func WithRetryPolicy(p RetryPolicy) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.retry = &p
+		return nil
+	}
+}
+
+// WithLimiter throttles every request through l
+func WithLimiter(l *Limiter) ClientOption {
+	return func(cfg *clientConfig) error {
+		cfg.limiter = l
+		return nil
+	}
+}
+
+// transportOptions tells whether an option requires building our own
+// http.Transport
+func (cfg *clientConfig) transportOptions() bool {
+	return cfg.proxy != nil || cfg.rootCAs != nil || len(cfg.certificates) > 0
+}
+
+// buildHTTPClient returns the http.Client matching the configuration, or nil
+// when the shared default one fits
+func (cfg *clientConfig) buildHTTPClient() (*http.Client, error) {
+	if cfg.httpClient != nil {
+		if cfg.roundTripper != nil || cfg.transportOptions() {
+			return nil, fmt.Errorf("NewClient(): WithHTTPClient cannot be combined with transport options")
+		}
+		if cfg.timeout == 0 {
+			return cfg.httpClient, nil
+		}
+		c := *cfg.httpClient
+		c.Timeout = cfg.timeout
+		return &c, nil
+	}
+
+	rt := cfg.roundTripper
+	if rt != nil && cfg.transportOptions() {
+		return nil, fmt.Errorf("NewClient(): WithTransport cannot be combined with WithProxy, WithRootCAs or WithClientCertificates")
+	}
+	if rt == nil {
+		if !cfg.transportOptions() && cfg.timeout == 0 {
+			return nil, nil
+		}
+		t := newTransport(&tls.Config{
+			InsecureSkipVerify: !cfg.verifyCert,
+			RootCAs:            cfg.rootCAs,
+			Certificates:       cfg.certificates,
+		})
+		if cfg.proxy != nil {
+			t.Proxy = http.ProxyURL(cfg.proxy)
+		}
+		rt = t
+	}
+
+	return &http.Client{
+		Transport: rt,
+		Timeout:   cfg.timeout,
+	}, nil
+}
+
+func newTransport(tlsConfig *tls.Config) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = tlsConfig
+	return t
+}
+
+// shared clients used when no custom http.Client was configured, so every
+// Client reuses the same connection pool
+var (
+	defaultHTTPClient = &http.Client{
+		Transport: newTransport(&tls.Config{}),
+	}
+	insecureHTTPClient = &http.Client{
+		Transport: newTransport(&tls.Config{InsecureSkipVerify: true}),
+	}
+)
@@ -0,0 +1,162 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// ProposeAttribute proposes to add attr to an event the user cannot edit.
+// The owner of the event accepts or discards the proposal.
+func (client *Client) ProposeAttribute(eventID string, attr Attribute) (ShadowAttribute, error) {
+	return client.ProposeAttributeContext(context.Background(), eventID, attr)
+}
+
+// ProposeAttributeContext is like ProposeAttribute but honors ctx
+func (client *Client) ProposeAttributeContext(ctx context.Context, eventID string, attr Attribute) (ShadowAttribute, error) {
+	data, err := proposalData(attr)
+	if err != nil {
+		return ShadowAttribute{}, err
+	}
+
+	resp, err := client.PostContext(ctx, "/shadow_attributes/add/"+eventID, data)
+	if err != nil {
+		return ShadowAttribute{}, err
+	}
+	return readShadowAttribute(resp)
+}
+
+// ProposeEdit proposes to replace the attribute attributeID with attr
+func (client *Client) ProposeEdit(attributeID string, attr Attribute) (ShadowAttribute, error) {
+	return client.ProposeEditContext(context.Background(), attributeID, attr)
+}
+
+// ProposeEditContext is like ProposeEdit but honors ctx
+func (client *Client) ProposeEditContext(ctx context.Context, attributeID string, attr Attribute) (ShadowAttribute, error) {
+	data, err := proposalData(attr)
+	if err != nil {
+		return ShadowAttribute{}, err
+	}
+	delete(data, "uuid")
+	delete(data, "event_id")
+
+	resp, err := client.PostContext(ctx, "/shadow_attributes/edit/"+attributeID, data)
+	if err != nil {
+		return ShadowAttribute{}, err
+	}
+	return readShadowAttribute(resp)
+}
+
+// ProposeDelete proposes to delete the attribute attributeID
+func (client *Client) ProposeDelete(attributeID string) (*Response, error) {
+	return client.ProposeDeleteContext(context.Background(), attributeID)
+}
+
+// ProposeDeleteContext is like ProposeDelete but honors ctx
+func (client *Client) ProposeDeleteContext(ctx context.Context, attributeID string) (*Response, error) {
+	return client.postResponse(ctx, "/shadow_attributes/delete/"+attributeID, nil)
+}
+
+// ListProposals lists the pending proposals on an event, or on every event
+// the user can see when eventID is empty
+func (client *Client) ListProposals(eventID string) ([]ShadowAttribute, error) {
+	return client.ListProposalsContext(context.Background(), eventID)
+}
+
+// ListProposalsContext is like ListProposals but honors ctx
+func (client *Client) ListProposalsContext(ctx context.Context, eventID string) ([]ShadowAttribute, error) {
+	var result []json.RawMessage
+
+	path := "/shadow_attributes/index"
+	if eventID != "" {
+		path += "/" + eventID
+	}
+	resp, err := client.GetContext(ctx, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	proposals := make([]ShadowAttribute, 0, len(result))
+	for _, raw := range result {
+		proposal, err := decodeShadowAttribute(raw)
+		if err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, proposal)
+	}
+	return proposals, nil
+}
+
+// AcceptProposal applies a proposal to the event
+func (client *Client) AcceptProposal(id string) (*Response, error) {
+	return client.AcceptProposalContext(context.Background(), id)
+}
+
+// AcceptProposalContext is like AcceptProposal but honors ctx
+func (client *Client) AcceptProposalContext(ctx context.Context, id string) (*Response, error) {
+	return client.postResponse(ctx, "/shadow_attributes/accept/"+id, nil)
+}
+
+// DiscardProposal drops a proposal without applying it
+func (client *Client) DiscardProposal(id string) (*Response, error) {
+	return client.DiscardProposalContext(context.Background(), id)
+}
+
+// DiscardProposalContext is like DiscardProposal but honors ctx
+func (client *Client) DiscardProposalContext(ctx context.Context, id string) (*Response, error) {
+	return client.postResponse(ctx, "/shadow_attributes/discard/"+id, nil)
+}
+
+// proposalData turns attr into the payload expected by /shadow_attributes/add
+// and /shadow_attributes/edit, without the elements MISP sets by itself
+func proposalData(attr Attribute) (map[string]interface{}, error) {
+	data, err := ToMap(attr)
+	if err != nil {
+		return nil, err
+	}
+	elem := []string{
+		"id",
+		"object_id",
+		"timestamp",
+		"deleted",
+	}
+	for _, item := range elem {
+		delete(data, item)
+	}
+	return data, nil
+}
+
+// readShadowAttribute decodes a proposal reply and closes its body
+func readShadowAttribute(resp *http.Response) (ShadowAttribute, error) {
+	var raw json.RawMessage
+
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	if err := decoder.Decode(&raw); err != nil {
+		return ShadowAttribute{}, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+	return decodeShadowAttribute(raw)
+}
+
+// decodeShadowAttribute decodes a proposal, wrapped in
+// {"ShadowAttribute": {...}} or not
+func decodeShadowAttribute(raw json.RawMessage) (proposal ShadowAttribute, err error) {
+	var wrapped map[string]json.RawMessage
+	if err = json.Unmarshal(raw, &wrapped); err != nil {
+		return proposal, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+	if inner, ok := wrapped["ShadowAttribute"]; ok {
+		raw = inner
+	}
+	if err = json.Unmarshal(raw, &proposal); err != nil {
+		return proposal, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+	return proposal, nil
+}
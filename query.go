@@ -0,0 +1,371 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Query is a restSearch body holding only the filters that were explicitly
+// set. Build one with a SearchBuilder.
+type Query map[string]interface{}
+
+// Terms is a MISP boolean filter on tags, values, types or organisations
+type Terms struct {
+	OR  []string `json:"OR,omitempty"`
+	AND []string `json:"AND,omitempty"`
+	NOT []string `json:"NOT,omitempty"`
+}
+
+// Or returns terms matching any of values
+func Or(values ...string) Terms {
+	return Terms{}.Or(values...)
+}
+
+// And returns terms matching all of values
+func And(values ...string) Terms {
+	return Terms{}.And(values...)
+}
+
+// Not returns terms matching none of values
+func Not(values ...string) Terms {
+	return Terms{}.Not(values...)
+}
+
+// Or adds values to the terms matching any of them
+func (t Terms) Or(values ...string) Terms {
+	t.OR = append(t.OR[:len(t.OR):len(t.OR)], values...)
+	return t
+}
+
+// And adds values to the terms matching all of them
+func (t Terms) And(values ...string) Terms {
+	t.AND = append(t.AND[:len(t.AND):len(t.AND)], values...)
+	return t
+}
+
+// Not adds values to the terms matching none of them
+func (t Terms) Not(values ...string) Terms {
+	t.NOT = append(t.NOT[:len(t.NOT):len(t.NOT)], values...)
+	return t
+}
+
+// MarshalJSON renders terms made of OR values only as a plain list, which
+// every MISP version understands
+func (t Terms) MarshalJSON() ([]byte, error) {
+	if len(t.AND) == 0 && len(t.NOT) == 0 {
+		if t.OR == nil {
+			return []byte("[]"), nil
+		}
+		return json.Marshal(t.OR)
+	}
+	type terms Terms
+	return json.Marshal(terms(t))
+}
+
+func (t Terms) validate() error {
+	if len(t.OR) == 0 && len(t.AND) == 0 && len(t.NOT) == 0 {
+		return fmt.Errorf("no terms")
+	}
+	for _, not := range t.NOT {
+		if contains(t.OR, not) || contains(t.AND, not) {
+			return fmt.Errorf("%q is both required and excluded", not)
+		}
+	}
+	return nil
+}
+
+// SearchBuilder builds a restSearch Query. Only the filters set through its
+// methods are sent, so Published(false) filters on unpublished events while
+// not calling Published does not filter at all.
+//
+//	query, err := misp.NewSearchBuilder().
+//		Tags(misp.Or("tlp:white", "tlp:green").Not("osint")).
+//		Since(24 * time.Hour).
+//		Published(true).
+//		Build()
+type SearchBuilder struct {
+	query Query
+	// setBy records which method set each key
+	setBy map[string]string
+	err   error
+}
+
+// NewSearchBuilder returns an empty SearchBuilder
+func NewSearchBuilder() *SearchBuilder {
+	return &SearchBuilder{
+		query: Query{},
+		setBy: map[string]string{},
+	}
+}
+
+// set stores value under key, failing when another method already set key
+func (b *SearchBuilder) set(method, key string, value interface{}) *SearchBuilder {
+	if prev, ok := b.setBy[key]; ok && prev != method && b.err == nil {
+		b.err = fmt.Errorf("SearchBuilder: %s conflicts with %s", method, prev)
+	}
+	b.setBy[key] = method
+	b.query[key] = value
+	return b
+}
+
+// fail records the first error found while building the query
+func (b *SearchBuilder) fail(method string, err error) *SearchBuilder {
+	if b.err == nil {
+		b.err = fmt.Errorf("SearchBuilder: %s: %s", method, err)
+	}
+	return b
+}
+
+func (b *SearchBuilder) terms(method, key string, t Terms) *SearchBuilder {
+	if err := t.validate(); err != nil {
+		return b.fail(method, err)
+	}
+	return b.set(method, key, t)
+}
+
+// Page selects the page of results, starting at 1
+func (b *SearchBuilder) Page(page int) *SearchBuilder {
+	if page < 1 {
+		return b.fail("Page", fmt.Errorf("invalid page %d", page))
+	}
+	return b.set("Page", "page", page)
+}
+
+// Limit caps the number of results per page
+func (b *SearchBuilder) Limit(limit int) *SearchBuilder {
+	if limit < 1 {
+		return b.fail("Limit", fmt.Errorf("invalid limit %d", limit))
+	}
+	return b.set("Limit", "limit", limit)
+}
+
+// Tags filters on tag names
+func (b *SearchBuilder) Tags(t Terms) *SearchBuilder {
+	return b.terms("Tags", "tags", t)
+}
+
+// Values filters on attribute values
+func (b *SearchBuilder) Values(t Terms) *SearchBuilder {
+	return b.terms("Values", "value", t)
+}
+
+// Types filters on attribute types
+func (b *SearchBuilder) Types(t Terms) *SearchBuilder {
+	return b.terms("Types", "type", t)
+}
+
+// Orgs filters on the creator organisation names or IDs
+func (b *SearchBuilder) Orgs(t Terms) *SearchBuilder {
+	return b.terms("Orgs", "org", t)
+}
+
+// Category filters on the attribute category
+func (b *SearchBuilder) Category(category Category) *SearchBuilder {
+	return b.set("Category", "category", category)
+}
+
+// EventID filters on event IDs
+func (b *SearchBuilder) EventID(ids ...string) *SearchBuilder {
+	return b.set("EventID", "eventid", ids)
+}
+
+// UUID filters on event or attribute UUIDs
+func (b *SearchBuilder) UUID(uuids ...string) *SearchBuilder {
+	return b.set("UUID", "uuid", uuids)
+}
+
+// EventInfo filters on the event info, % being a wildcard
+func (b *SearchBuilder) EventInfo(info string) *SearchBuilder {
+	return b.set("EventInfo", "eventinfo", info)
+}
+
+// SearchAll matches value against every text field
+func (b *SearchBuilder) SearchAll(value string) *SearchBuilder {
+	return b.set("SearchAll", "searchall", value)
+}
+
+// ObjectName filters objects on their template name, such as "file"
+func (b *SearchBuilder) ObjectName(name string) *SearchBuilder {
+	return b.set("ObjectName", "object_name", name)
+}
+
+// ObjectTemplateUUID filters objects on their template UUID
+func (b *SearchBuilder) ObjectTemplateUUID(uuid string) *SearchBuilder {
+	return b.set("ObjectTemplateUUID", "object_template_uuid", uuid)
+}
+
+// ThreatLevel filters on the event threat level
+func (b *SearchBuilder) ThreatLevel(level ThreatLevel) *SearchBuilder {
+	return b.set("ThreatLevel", "threat_level_id", level)
+}
+
+// Published filters on the published flag of events
+func (b *SearchBuilder) Published(published bool) *SearchBuilder {
+	return b.set("Published", "published", published)
+}
+
+// ToIDS filters on the to_ids flag of attributes
+func (b *SearchBuilder) ToIDS(toIDS bool) *SearchBuilder {
+	return b.set("ToIDS", "to_ids", toIDS)
+}
+
+// Deleted includes soft deleted attributes
+func (b *SearchBuilder) Deleted(deleted bool) *SearchBuilder {
+	return b.set("Deleted", "deleted", deleted)
+}
+
+// Metadata returns events without their attributes and objects
+func (b *SearchBuilder) Metadata(metadata bool) *SearchBuilder {
+	return b.set("Metadata", "metadata", metadata)
+}
+
+// WithAttachments includes the content of attachments
+func (b *SearchBuilder) WithAttachments(with bool) *SearchBuilder {
+	return b.set("WithAttachments", "withAttachments", with)
+}
+
+// IncludeEventTags adds the event tags to each attribute
+func (b *SearchBuilder) IncludeEventTags(include bool) *SearchBuilder {
+	return b.set("IncludeEventTags", "includeEventTags", include)
+}
+
+// EnforceWarningList drops attributes matching a warning list
+func (b *SearchBuilder) EnforceWarningList(enforce bool) *SearchBuilder {
+	return b.set("EnforceWarningList", "enforceWarninglist", enforce)
+}
+
+// ReturnFormat selects the format of the reply
+func (b *SearchBuilder) ReturnFormat(format string) *SearchBuilder {
+	return b.set("ReturnFormat", "returnFormat", format)
+}
+
+// Since keeps what changed during the last d, measured on the modification
+// timestamp by the server
+func (b *SearchBuilder) Since(d time.Duration) *SearchBuilder {
+	if d <= 0 {
+		return b.fail("Since", fmt.Errorf("invalid duration %s", d))
+	}
+	return b.set("Since", "timestamp", relativeTime(d))
+}
+
+// Between keeps what changed between from and to
+func (b *SearchBuilder) Between(from, to time.Time) *SearchBuilder {
+	if to.Before(from) {
+		return b.fail("Between", fmt.Errorf("%s is before %s", to, from))
+	}
+	return b.set("Between", "timestamp", []UnixTime{{from}, {to}})
+}
+
+// Last keeps the events published during the last d
+func (b *SearchBuilder) Last(d time.Duration) *SearchBuilder {
+	if d <= 0 {
+		return b.fail("Last", fmt.Errorf("invalid duration %s", d))
+	}
+	return b.set("Last", "last", relativeTime(d))
+}
+
+// Dates keeps the events dated between from and to, inclusive. A zero time
+// leaves that end open.
+func (b *SearchBuilder) Dates(from, to time.Time) *SearchBuilder {
+	if !from.IsZero() && !to.IsZero() && to.Before(from) {
+		return b.fail("Dates", fmt.Errorf("%s is before %s", to, from))
+	}
+	if !from.IsZero() {
+		b.set("Dates", "from", NewMISPDate(from))
+	}
+	if !to.IsZero() {
+		b.set("Dates", "to", NewMISPDate(to))
+	}
+	return b
+}
+
+// Set sets a filter the builder has no method for
+func (b *SearchBuilder) Set(key string, value interface{}) *SearchBuilder {
+	return b.set("Set("+strconv.Quote(key)+")", key, value)
+}
+
+// Build validates the filters and returns the query
+func (b *SearchBuilder) Build() (Query, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+	if _, ok := b.setBy["last"]; ok {
+		if published, ok := b.query["published"].(bool); ok && !published {
+			return nil, fmt.Errorf("SearchBuilder: Last only matches published events, it conflicts with Published(false)")
+		}
+	}
+
+	query := make(Query, len(b.query))
+	for key, value := range b.query {
+		query[key] = value
+	}
+	return query, nil
+}
+
+// relativeTime renders d the way restSearch expects relative times, in the
+// largest unit dividing it
+func relativeTime(d time.Duration) string {
+	d = d.Round(time.Second)
+	if d < time.Second {
+		d = time.Second
+	}
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%dm", d/time.Minute)
+	}
+	return fmt.Sprintf("%ds", d/time.Second)
+}
+
+// SearchQuery is like Search but sends a Query built by a SearchBuilder
+func (client *Client) SearchQuery(controller string, query Query) ([]byte, error) {
+	return client.SearchQueryContext(context.Background(), controller, query)
+}
+
+// SearchQueryContext is like SearchQuery but honors ctx
+func (client *Client) SearchQueryContext(ctx context.Context, controller string, query Query) ([]byte, error) {
+	return client.searchAll(ctx, controller, query)
+}
+
+// SearchEventsQuery is like SearchEvents but sends a Query built by a
+// SearchBuilder
+func (client *Client) SearchEventsQuery(query Query) (SearchEventsResult, error) {
+	return client.SearchEventsQueryContext(context.Background(), query)
+}
+
+// SearchEventsQueryContext is like SearchEventsQuery but honors ctx
+func (client *Client) SearchEventsQueryContext(ctx context.Context, query Query) (events SearchEventsResult, err error) {
+	err = client.searchDecode(ctx, "events", query, &events)
+	return
+}
+
+// SearchAttributesQuery is like SearchAttributes but sends a Query built by
+// a SearchBuilder
+func (client *Client) SearchAttributesQuery(query Query) (SearchAttributesResult, error) {
+	return client.SearchAttributesQueryContext(context.Background(), query)
+}
+
+// SearchAttributesQueryContext is like SearchAttributesQuery but honors ctx
+func (client *Client) SearchAttributesQueryContext(ctx context.Context, query Query) (attributes SearchAttributesResult, err error) {
+	err = client.searchDecode(ctx, "attributes", query, &attributes)
+	return
+}
+
+// SearchObjectsQuery is like SearchObjects but sends a Query built by a
+// SearchBuilder
+func (client *Client) SearchObjectsQuery(query Query) ([]Object, error) {
+	return client.SearchObjectsQueryContext(context.Background(), query)
+}
+
+// SearchObjectsQueryContext is like SearchObjectsQuery but honors ctx
+func (client *Client) SearchObjectsQueryContext(ctx context.Context, query Query) ([]Object, error) {
+	var result searchObjectsResult
+	err := client.searchDecode(ctx, "objects", query, &result)
+	return result.objects(), err
+}
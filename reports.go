@@ -0,0 +1,254 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// EventReport is a markdown narrative attached to an event
+type EventReport struct {
+	ID             FlexString   `json:"id,omitempty"`
+	UUID           string       `json:"uuid"`
+	EventID        FlexString   `json:"event_id,omitempty"`
+	Name           string       `json:"name"`
+	Content        string       `json:"content"`
+	Distribution   Distribution `json:"distribution"`
+	SharingGroupID FlexString   `json:"sharing_group_id,omitempty"`
+	Timestamp      UnixTime     `json:"timestamp"`
+	Deleted        FlexBool     `json:"deleted"`
+}
+
+// NewEventReport returns a report inheriting the distribution of its event
+func NewEventReport(name, content string) EventReport {
+	return EventReport{
+		UUID:         uuid.NewString(),
+		Name:         name,
+		Content:      content,
+		Distribution: DistributionInheritEvent,
+	}
+}
+
+// ListEventReports lists the reports of an event
+func (client *Client) ListEventReports(eventID string) ([]EventReport, error) {
+	return client.ListEventReportsContext(context.Background(), eventID)
+}
+
+// ListEventReportsContext is like ListEventReports but honors ctx
+func (client *Client) ListEventReportsContext(ctx context.Context, eventID string) ([]EventReport, error) {
+	var result []struct {
+		EventReport EventReport `json:"EventReport"`
+	}
+
+	resp, err := client.GetContext(ctx, "/event_reports/index/event_id:"+eventID, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	reports := make([]EventReport, 0, len(result))
+	for _, item := range result {
+		reports = append(reports, item.EventReport)
+	}
+	return reports, nil
+}
+
+// Get an event report by ID or UUID
+func (client *Client) GetEventReport(id string) (EventReport, error) {
+	return client.GetEventReportContext(context.Background(), id)
+}
+
+// GetEventReportContext is like GetEventReport but honors ctx
+func (client *Client) GetEventReportContext(ctx context.Context, id string) (EventReport, error) {
+	resp, err := client.GetContext(ctx, "/event_reports/view/"+id, nil)
+	if err != nil {
+		return EventReport{}, err
+	}
+	return readEventReport(resp)
+}
+
+// AddEventReport adds a report to an event
+func (client *Client) AddEventReport(eventID string, report EventReport) (EventReport, error) {
+	return client.AddEventReportContext(context.Background(), eventID, report)
+}
+
+// AddEventReportContext is like AddEventReport but honors ctx
+func (client *Client) AddEventReportContext(ctx context.Context, eventID string, report EventReport) (EventReport, error) {
+	resp, err := client.PostContext(ctx, "/event_reports/add/"+eventID, reportData(report))
+	if err != nil {
+		return EventReport{}, err
+	}
+	return readEventReport(resp)
+}
+
+// UpdateEventReport edits an existing report, identified by its ID or else
+// its UUID
+func (client *Client) UpdateEventReport(report EventReport) (EventReport, error) {
+	return client.UpdateEventReportContext(context.Background(), report)
+}
+
+// UpdateEventReportContext is like UpdateEventReport but honors ctx
+func (client *Client) UpdateEventReportContext(ctx context.Context, report EventReport) (EventReport, error) {
+	id := string(report.ID)
+	if id == "" {
+		id = report.UUID
+	}
+	if id == "" {
+		return EventReport{}, fmt.Errorf("UpdateEventReport(): report has no ID nor UUID")
+	}
+
+	resp, err := client.PostContext(ctx, "/event_reports/edit/"+id, reportData(report))
+	if err != nil {
+		return EventReport{}, err
+	}
+	return readEventReport(resp)
+}
+
+// DeleteEventReport soft deletes a report, or removes it for good when hard
+// is set
+func (client *Client) DeleteEventReport(id string, hard bool) (*Response, error) {
+	return client.DeleteEventReportContext(context.Background(), id, hard)
+}
+
+// DeleteEventReportContext is like DeleteEventReport but honors ctx
+func (client *Client) DeleteEventReportContext(ctx context.Context, id string, hard bool) (*Response, error) {
+	path := "/event_reports/delete/" + id
+	if hard {
+		path += "/1"
+	}
+	return client.postResponse(ctx, path, nil)
+}
+
+// reportData returns the fields of report MISP lets clients set
+func reportData(report EventReport) map[string]interface{} {
+	data := map[string]interface{}{
+		"name":         report.Name,
+		"content":      report.Content,
+		"distribution": report.Distribution,
+	}
+	if report.UUID != "" {
+		data["uuid"] = report.UUID
+	}
+	if report.SharingGroupID != "" {
+		data["sharing_group_id"] = report.SharingGroupID
+	}
+	return data
+}
+
+// readEventReport decodes a {"EventReport": {...}} reply and closes its body
+func readEventReport(resp *http.Response) (report EventReport, err error) {
+	var result map[string]EventReport
+
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return report, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+	return result["EventReport"], nil
+}
+
+// Kinds of ReportReference
+const (
+	ReferenceAttribute = "attribute"
+	ReferenceObject    = "object"
+)
+
+// ReportReference is a reference to an element of the event in the markdown
+// of a report, written @[kind](uuid)
+type ReportReference struct {
+	Kind string
+	UUID string
+}
+
+// AttributeMarkdown returns the markdown referencing the attribute uuid
+func AttributeMarkdown(uuid string) string {
+	return ReportReference{Kind: ReferenceAttribute, UUID: uuid}.String()
+}
+
+// ObjectMarkdown returns the markdown referencing the object uuid
+func ObjectMarkdown(uuid string) string {
+	return ReportReference{Kind: ReferenceObject, UUID: uuid}.String()
+}
+
+// String renders the reference as MISP markdown
+func (r ReportReference) String() string {
+	return fmt.Sprintf("@[%s](%s)", r.Kind, r.UUID)
+}
+
+var reportReferenceRe = regexp.MustCompile(`@\[([a-z-]+)\]\(([^()\s]+)\)`)
+
+// ParseReportReferences returns the references found in the markdown, in
+// order of appearance
+func ParseReportReferences(content string) []ReportReference {
+	var refs []ReportReference
+	for _, m := range reportReferenceRe.FindAllStringSubmatch(content, -1) {
+		refs = append(refs, ReportReference{Kind: m[1], UUID: m[2]})
+	}
+	return refs
+}
+
+// ReplaceReportReferences replaces every reference of the markdown with what
+// replace returns for it, leaving it as is when replace returns false
+func ReplaceReportReferences(content string, replace func(ReportReference) (string, bool)) string {
+	return reportReferenceRe.ReplaceAllStringFunc(content, func(match string) string {
+		m := reportReferenceRe.FindStringSubmatch(match)
+		if s, ok := replace(ReportReference{Kind: m[1], UUID: m[2]}); ok {
+			return s
+		}
+		return match
+	})
+}
+
+// ExpandReportReferences renders the attribute and object references of the
+// markdown as plain markdown, using the elements of event: an attribute
+// becomes its value in code span and an object its name in bold. Unknown
+// references are left as is.
+func ExpandReportReferences(content string, event Event) string {
+	attributes := make(map[string]Attribute)
+	objects := make(map[string]Object)
+	for _, attr := range event.Attribute {
+		attributes[attr.UUID] = attr
+	}
+	for _, obj := range event.Object {
+		objects[obj.UUID] = obj
+		for _, attr := range obj.Attribute {
+			attributes[attr.UUID] = attr
+		}
+	}
+
+	return ReplaceReportReferences(content, func(ref ReportReference) (string, bool) {
+		switch ref.Kind {
+		case ReferenceAttribute:
+			if attr, ok := attributes[ref.UUID]; ok {
+				return codeSpan(attr.Value), true
+			}
+		case ReferenceObject:
+			if obj, ok := objects[ref.UUID]; ok {
+				return "**" + obj.Name + "**", true
+			}
+		}
+		return "", false
+	})
+}
+
+// codeSpan wraps s in a markdown code span long enough to hold its backticks
+func codeSpan(s string) string {
+	fence := "`"
+	for strings.Contains(s, fence) {
+		fence += "`"
+	}
+	if strings.HasPrefix(s, "`") || strings.HasSuffix(s, "`") {
+		return fence + " " + s + " " + fence
+	}
+	return fence + s + fence
+}
@@ -0,0 +1,172 @@
+package misp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// RetryPolicy describes how failed requests are retried. Only idempotent
+// requests, and the ones marked with RetrySafe, are retried.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts, first one included
+	MaxAttempts int
+	// MinBackoff is the wait before the first retry, doubled on every
+	// following one up to MaxBackoff
+	MinBackoff time.Duration
+	MaxBackoff time.Duration
+	// Statuses lists the HTTP status codes worth retrying, defaults to
+	// DefaultRetryStatuses
+	Statuses []int
+	// RetryAll retries every request, even the non idempotent ones
+	RetryAll bool
+}
+
+// DefaultRetryStatuses are the status codes retried when
+// RetryPolicy.Statuses is empty
+var DefaultRetryStatuses = []int{
+	http.StatusTooManyRequests,
+	http.StatusBadGateway,
+	http.StatusServiceUnavailable,
+	http.StatusGatewayTimeout,
+}
+
+// DefaultRetryPolicy returns a reasonable policy for a MISP instance behind
+// a reverse proxy
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxAttempts: 4,
+		MinBackoff:  500 * time.Millisecond,
+		MaxBackoff:  30 * time.Second,
+	}
+}
+
+// RetryError is returned when a request still failed after being retried
+type RetryError struct {
+	Attempts int
+	// Err is the error of the last attempt
+	Err error
+}
+
+func (e *RetryError) Error() string {
+	return fmt.Sprintf("giving up after %d attempts: %s", e.Attempts, e.Err)
+}
+
+func (e *RetryError) Unwrap() error {
+	return e.Err
+}
+
+type retrySafeKey struct{}
+
+// RetrySafe marks the requests issued with the returned context as safe to
+// retry, for POST requests that do not modify anything
+func RetrySafe(ctx context.Context) context.Context {
+	return context.WithValue(ctx, retrySafeKey{}, true)
+}
+
+// retryable tells whether a request may be replayed
+func (p *RetryPolicy) retryable(ctx context.Context, method string) bool {
+	if p.RetryAll {
+		return true
+	}
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "PUT", "DELETE":
+		return true
+	}
+	safe, _ := ctx.Value(retrySafeKey{}).(bool)
+	return safe
+}
+
+// do runs send until it succeeds, fails for good or the attempts run out
+func (p *RetryPolicy) do(ctx context.Context, send func() (*http.Response, error)) (*http.Response, error) {
+	for attempt := 1; ; attempt++ {
+		resp, err := send()
+		if err == nil || attempt >= p.MaxAttempts || ctx.Err() != nil || !p.shouldRetry(resp, err) {
+			if err != nil && attempt > 1 {
+				err = &RetryError{Attempts: attempt, Err: err}
+			}
+			return resp, err
+		}
+
+		wait := p.backoff(attempt, resp)
+		if resp != nil {
+			io.Copy(ioutil.Discard, resp.Body)
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, &RetryError{Attempts: attempt, Err: ctx.Err()}
+		case <-timer.C:
+		}
+	}
+}
+
+func (p *RetryPolicy) shouldRetry(resp *http.Response, err error) bool {
+	if resp == nil {
+		// transport error: connection refused, reset...
+		return true
+	}
+	statuses := p.Statuses
+	if len(statuses) == 0 {
+		statuses = DefaultRetryStatuses
+	}
+	for _, status := range statuses {
+		if resp.StatusCode == status {
+			return true
+		}
+	}
+	return false
+}
+
+// backoff returns how long to wait after the given failed attempt, honoring
+// the Retry-After header when the server sent one, up to MaxBackoff
+func (p *RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if wait, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+				wait = p.MaxBackoff
+			}
+			return wait
+		}
+	}
+
+	wait := p.MinBackoff
+	for i := 1; i < attempt && (p.MaxBackoff == 0 || wait < p.MaxBackoff); i++ {
+		wait *= 2
+	}
+	if p.MaxBackoff > 0 && wait > p.MaxBackoff {
+		wait = p.MaxBackoff
+	}
+	if wait <= 0 {
+		return 0
+	}
+	// jitter between half and the full backoff
+	half := int64(wait / 2)
+	return time.Duration(half + rand.Int63n(half+1))
+}
+
+// parseRetryAfter decodes a Retry-After header, in seconds or as an HTTP date
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if secs, err := strconv.Atoi(value); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		wait := time.Until(date)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
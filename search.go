@@ -1,69 +1,99 @@
 package misp
 
 import (
+	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"strings"
 )
 
+// Search is a restSearch request. Zero fields are left out, use a
+// SearchBuilder to filter on false booleans or with boolean terms.
 type Search struct {
-	Page                   int      `json:"page"`
-	Limit                  int      `json:"limit"`
-	Value                  string   `json:"value"`
-	Type                   string   `json:"type"`
-	Category               string   `json:"category"`
-	Org                    string   `json:"org"`
-	Tags                   []string `json:"tags"`
-	SearchAll              string   `json:"searchall"`
-	From                   string   `json:"from"`
-	To                     string   `json:"to"`
-	Last                   int      `json:"last"`
-	EventID                string   `json:"eventid"`
-	WithAttachments        bool     `json:"withAttachments"`
-	Metadata               bool     `json:"metadata"`
-	UUID                   string   `json:"uuid"`
-	PublishTimestamp       string   `json:"publish_timestamp"`
-	Published              bool     `json:"published"`
-	Timestamp              string   `json:"timestamp"`
-	AttributeTimestamp     string   `json:"attribute_timestamp"`
-	EnforceWarningList     bool     `json:"enforceWarninglist"`
-	ToIDS                  bool     `json:"to_ids"`
-	Deleted                bool     `json:"deleted"`
-	EventTimestamp         string   `json:"event_timestamp"`
-	ThreatLevelID          string   `json:"threat_level_id"`
-	EventInfo              string   `json:"eventinfo"`
-	DecayingModel          string   `json:"decayingModel"`
-	Score                  string   `json:"score"`
-	FirstSeen              string   `json:"first_seen"`
-	LastSeen               string   `json:"last_seen"`
-	IncludeEventUUID       bool     `json:"includeEventUuid"`
-	IncludeEventTags       bool     `json:"includeEventTags"`
-	IncludeProposals       bool     `json:"includeProposals"`
-	RequestedAttributes    []string `json:"requested_attributes"`
-	IncludeContext         bool     `json:"includeContext"`
-	Headerless             bool     `json:"headerless"`
-	IncludeWarningListHits bool     `json:"includeWarninglistHits"`
-	AttackGalaxy           string   `json:"attackGalaxy"`
-	ObjectRelation         string   `json:"object_relation"`
-	IncludeSightings       bool     `json:"includeSightings"`
-	IncludeCorrelations    bool     `json:"includeCorrelations"`
-	ModelOverrides         struct {
-		Lifetime         int         `json:"lifetime"`
-		DecaySpeed       float64     `json:"decay_speed"`
-		Threshold        int         `json:"threshold"`
-		DefaultBaseScore int         `json:"default_base_score"`
-		BaseScoreConfig  interface{} `json:"base_score_config"`
-	} `json:"modelOverrides"`
-	IncludeDecayScore bool   `json:"includeDecayScore"`
-	IncludeFullModel  bool   `json:"includeFullModel"`
-	ExcludeDecayed    bool   `json:"excludeDecayed"`
-	ReturnFormat      string `json:"returnFormat"`
-	SgReferenceOnly   bool   `json:"sgReferenceOnly"`
-	ExcludeLocalTags  bool   `json:"excludeLocalTags"`
-	Date              string `json:"date"`
-	IncludeSightingDB bool   `json:"includeSightingdb"`
-	Tag               string `json:"tag"`
+	Page                   int            `json:"page,omitempty"`
+	Limit                  int            `json:"limit,omitempty"`
+	Value                  string         `json:"value,omitempty"`
+	Type                   string         `json:"type,omitempty"`
+	Category               string         `json:"category,omitempty"`
+	Org                    string         `json:"org,omitempty"`
+	Tags                   []string       `json:"tags,omitempty"`
+	SearchAll              string         `json:"searchall,omitempty"`
+	From                   string         `json:"from,omitempty"`
+	To                     string         `json:"to,omitempty"`
+	Last                   int            `json:"last,omitempty"`
+	EventID                string         `json:"eventid,omitempty"`
+	WithAttachments        bool           `json:"withAttachments,omitempty"`
+	Metadata               bool           `json:"metadata,omitempty"`
+	UUID                   string         `json:"uuid,omitempty"`
+	PublishTimestamp       string         `json:"publish_timestamp,omitempty"`
+	Published              bool           `json:"published,omitempty"`
+	Timestamp              string         `json:"timestamp,omitempty"`
+	AttributeTimestamp     string         `json:"attribute_timestamp,omitempty"`
+	EnforceWarningList     bool           `json:"enforceWarninglist,omitempty"`
+	ToIDS                  bool           `json:"to_ids,omitempty"`
+	Deleted                bool           `json:"deleted,omitempty"`
+	EventTimestamp         string         `json:"event_timestamp,omitempty"`
+	ThreatLevelID          string         `json:"threat_level_id,omitempty"`
+	EventInfo              string         `json:"eventinfo,omitempty"`
+	DecayingModel          string         `json:"decayingModel,omitempty"`
+	Score                  string         `json:"score,omitempty"`
+	FirstSeen              string         `json:"first_seen,omitempty"`
+	LastSeen               string         `json:"last_seen,omitempty"`
+	IncludeEventUUID       bool           `json:"includeEventUuid,omitempty"`
+	IncludeEventTags       bool           `json:"includeEventTags,omitempty"`
+	IncludeProposals       bool           `json:"includeProposals,omitempty"`
+	RequestedAttributes    []string       `json:"requested_attributes,omitempty"`
+	IncludeContext         bool           `json:"includeContext,omitempty"`
+	Headerless             bool           `json:"headerless,omitempty"`
+	IncludeWarningListHits bool           `json:"includeWarninglistHits,omitempty"`
+	AttackGalaxy           string         `json:"attackGalaxy,omitempty"`
+	ObjectRelation         string         `json:"object_relation,omitempty"`
+	IncludeSightings       bool           `json:"includeSightings,omitempty"`
+	IncludeCorrelations    bool           `json:"includeCorrelations,omitempty"`
+	ModelOverrides         ModelOverrides `json:"modelOverrides,omitempty"`
+	IncludeDecayScore      bool           `json:"includeDecayScore,omitempty"`
+	IncludeFullModel       bool           `json:"includeFullModel,omitempty"`
+	ExcludeDecayed         bool           `json:"excludeDecayed,omitempty"`
+	ReturnFormat           string         `json:"returnFormat,omitempty"`
+	SgReferenceOnly        bool           `json:"sgReferenceOnly,omitempty"`
+	ExcludeLocalTags       bool           `json:"excludeLocalTags,omitempty"`
+	Date                   string         `json:"date,omitempty"`
+	IncludeSightingDB      bool           `json:"includeSightingdb,omitempty"`
+	Tag                    string         `json:"tag,omitempty"`
+	// ObjectName and ObjectTemplateUUID only apply to objects searches
+	ObjectName         string `json:"object_name,omitempty"`
+	ObjectTemplateUUID string `json:"object_template_uuid,omitempty"`
+}
+
+// ModelOverrides overrides the decaying model parameters of a search
+type ModelOverrides struct {
+	Lifetime         int         `json:"lifetime,omitempty"`
+	DecaySpeed       float64     `json:"decay_speed,omitempty"`
+	Threshold        int         `json:"threshold,omitempty"`
+	DefaultBaseScore int         `json:"default_base_score,omitempty"`
+	BaseScoreConfig  interface{} `json:"base_score_config,omitempty"`
+}
+
+// isZero tells whether no parameter is overridden
+func (m ModelOverrides) isZero() bool {
+	return m.Lifetime == 0 && m.DecaySpeed == 0 && m.Threshold == 0 &&
+		m.DefaultBaseScore == 0 && m.BaseScoreConfig == nil
+}
+
+// MarshalJSON leaves modelOverrides out when no parameter is overridden,
+// omitempty having no effect on structs
+func (s Search) MarshalJSON() ([]byte, error) {
+	type search Search
+	var overrides *ModelOverrides
+	if !s.ModelOverrides.isZero() {
+		overrides = &s.ModelOverrides
+	}
+	return json.Marshal(struct {
+		search
+		ModelOverrides *ModelOverrides `json:"modelOverrides,omitempty"`
+	}{search(s), overrides})
 }
 
 type IndexSearch struct {
@@ -100,8 +130,55 @@ type SearchAttributesResult struct {
 	Response map[string][]Attribute `json:"response"`
 }
 
+func (r *SearchAttributesResult) UnmarshalJSON(data []byte) error {
+	var outer searchOuterResponse
+	if err := json.Unmarshal(data, &outer); err != nil {
+		return err
+	}
+
+	r.Response = nil
+	// no match comes back as an empty array
+	response := bytes.TrimSpace(outer.Response)
+	if len(response) == 0 || response[0] == '[' {
+		return nil
+	}
+	return json.Unmarshal(response, &r.Response)
+}
+
 // Search events, attributes or objects in the MISP instance
 func (client *Client) Search(controller string, search *Search) (result []byte, err error) {
+	return client.SearchContext(context.Background(), controller, search)
+}
+
+// SearchContext is like Search but honors ctx
+func (client *Client) SearchContext(ctx context.Context, controller string, search *Search) (result []byte, err error) {
+	return client.searchAll(ctx, controller, search)
+}
+
+// searchAll sends the restSearch request and returns the whole JSON reply
+func (client *Client) searchAll(ctx context.Context, controller string, search interface{}) ([]byte, error) {
+	body, err := client.searchBody(ctx, controller, search, "application/json")
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return io.ReadAll(body)
+}
+
+// searchDecode sends the restSearch request and decodes the JSON reply into
+// result
+func (client *Client) searchDecode(ctx context.Context, controller string, search interface{}, result interface{}) error {
+	body, err := client.searchBody(ctx, controller, search, "application/json")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return json.NewDecoder(body).Decode(result)
+}
+
+// searchBody sends the restSearch request and returns the reply body, which
+// the caller must close
+func (client *Client) searchBody(ctx context.Context, controller string, search interface{}, accept string) (io.ReadCloser, error) {
 	var (
 		path        string
 		controllers []string = []string{
@@ -116,35 +193,72 @@ func (client *Client) Search(controller string, search *Search) (result []byte,
 		}
 	}
 	if invalid_controller {
-		return result, fmt.Errorf("Search(): Invalid controller")
+		return nil, fmt.Errorf("Search(): Invalid controller")
 	}
 	path = fmt.Sprintf("/%s/restSearch", controller)
 
-	res, err := client.Post(path, search)
+	// restSearch does not modify anything, it can be replayed
+	res, err := client.do(RetrySafe(ctx), "POST", path, search, accept)
 	if err != nil {
-		return
+		return nil, err
 	}
-	defer res.Body.Close()
-	return io.ReadAll(res.Body)
+	return res.Body, nil
 }
 
 func (client *Client) SearchEvents(search *Search) (events SearchEventsResult, err error) {
-	if data, err := client.Search("events", search); err == nil {
-		err = json.Unmarshal(data, &events)
-	}
+	return client.SearchEventsContext(context.Background(), search)
+}
+
+// SearchEventsContext is like SearchEvents but honors ctx
+func (client *Client) SearchEventsContext(ctx context.Context, search *Search) (events SearchEventsResult, err error) {
+	err = client.searchDecode(ctx, "events", search, &events)
 	return
 }
 
 func (client *Client) SearchAttributes(search *Search) (attributes SearchAttributesResult, err error) {
-	if data, err := client.Search("attributes", search); err == nil {
-		err = json.Unmarshal(data, &attributes)
-	}
+	return client.SearchAttributesContext(context.Background(), search)
+}
+
+// SearchAttributesContext is like SearchAttributes but honors ctx
+func (client *Client) SearchAttributesContext(ctx context.Context, search *Search) (attributes SearchAttributesResult, err error) {
+	err = client.searchDecode(ctx, "attributes", search, &attributes)
 	return
 }
 
+func (client *Client) SearchObjects(search *Search) (objects []Object, err error) {
+	return client.SearchObjectsContext(context.Background(), search)
+}
+
+// SearchObjectsContext is like SearchObjects but honors ctx
+func (client *Client) SearchObjectsContext(ctx context.Context, search *Search) (objects []Object, err error) {
+	var result searchObjectsResult
+	err = client.searchDecode(ctx, "objects", search, &result)
+	return result.objects(), err
+}
+
+// searchObjectsResult is the reply of /objects/restSearch
+type searchObjectsResult struct {
+	Response []struct {
+		Object Object `json:"Object"`
+	} `json:"response"`
+}
+
+func (r searchObjectsResult) objects() []Object {
+	objects := make([]Object, 0, len(r.Response))
+	for _, item := range r.Response {
+		objects = append(objects, item.Object)
+	}
+	return objects
+}
+
 // Search event metadata shown on the event index page
 func (client *Client) SearchIndex(search *IndexSearch) (result []Event, err error) {
-	res, err := client.Post("/events/index", *search)
+	return client.SearchIndexContext(context.Background(), search)
+}
+
+// SearchIndexContext is like SearchIndex but honors ctx
+func (client *Client) SearchIndexContext(ctx context.Context, search *IndexSearch) (result []Event, err error) {
+	res, err := client.PostContext(RetrySafe(ctx), "/events/index", *search)
 	if err != nil {
 		return
 	}
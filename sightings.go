@@ -0,0 +1,220 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+)
+
+// maxSightingValues caps the values sent in a single /sightings/add request
+const maxSightingValues = 500
+
+// AddSighting ... XXX
+func (client *Client) AddSighting(s *Sighting) (*Response, error) {
+	return client.AddSightingContext(context.Background(), s)
+}
+
+// AddSightingContext is like AddSighting but honors ctx
+func (client *Client) AddSightingContext(ctx context.Context, s *Sighting) (*Response, error) {
+	data, err := sightingData(s)
+	if err != nil {
+		return nil, err
+	}
+	return client.postResponse(ctx, "/sightings/add/", Request{Request: data})
+}
+
+// AddSightings adds many sightings with as few requests as possible. The
+// sightings given by value are coalesced into one request per type, source,
+// organisation and time, without duplicate values; the ones given by attribute UUID or ID
+// are sent one by one. It stops at the first failed request and returns the
+// replies received so far.
+func (client *Client) AddSightings(sightings []Sighting) ([]*Response, error) {
+	return client.AddSightingsContext(context.Background(), sightings)
+}
+
+// AddSightingsContext is like AddSightings but honors ctx
+func (client *Client) AddSightingsContext(ctx context.Context, sightings []Sighting) ([]*Response, error) {
+	var responses []*Response
+
+	for _, s := range coalesceSightings(sightings, maxSightingValues) {
+		resp, err := client.AddSightingContext(ctx, &s)
+		if err != nil {
+			return responses, err
+		}
+		responses = append(responses, resp)
+	}
+	return responses, nil
+}
+
+// sightingKey identifies the sightings which can share a request
+type sightingKey struct {
+	Type      SightingType
+	Source    string
+	OrgID     FlexString
+	Timestamp int
+}
+
+// coalesceSightings merges the sightings by value sharing a sightingKey into
+// sightings of at most max values, keeping the order of first appearance
+func coalesceSightings(sightings []Sighting, max int) []Sighting {
+	var (
+		result []Sighting
+		keys   []sightingKey
+	)
+	values := make(map[sightingKey][]string)
+	seen := make(map[sightingKey]map[string]bool)
+
+	for _, s := range sightings {
+		if s.UUID != "" || s.ID != "" {
+			result = append(result, s)
+			continue
+		}
+
+		key := sightingKey{
+			Type:      s.Type,
+			Source:    s.Source,
+			OrgID:     s.OrgID,
+			Timestamp: sightingTimestamp(&s),
+		}
+		if seen[key] == nil {
+			seen[key] = make(map[string]bool)
+			keys = append(keys, key)
+		}
+		for _, value := range append([]string{s.Value}, s.Values...) {
+			if value == "" || seen[key][value] {
+				continue
+			}
+			seen[key][value] = true
+			values[key] = append(values[key], value)
+		}
+	}
+
+	for _, key := range keys {
+		list := values[key]
+		for len(list) > 0 {
+			n := len(list)
+			if n > max {
+				n = max
+			}
+			result = append(result, Sighting{
+				Values:    list[:n],
+				Type:      key.Type,
+				Source:    key.Source,
+				OrgID:     key.OrgID,
+				Timestamp: key.Timestamp,
+			})
+			list = list[n:]
+		}
+	}
+	return result
+}
+
+// sightingTimestamp returns the Unix time the sighting is recorded at, zero
+// for now
+func sightingTimestamp(s *Sighting) int {
+	if s.Timestamp == 0 && !s.DateSighting.IsZero() {
+		return int(s.DateSighting.Unix())
+	}
+	return s.Timestamp
+}
+
+// sightingData turns s into the payload expected by /sightings/add, which
+// takes the time of the sighting as timestamp
+func sightingData(s *Sighting) (map[string]interface{}, error) {
+	data, err := ToMap(s)
+	if err != nil {
+		return nil, err
+	}
+	delete(data, "date_sighting")
+	if ts := sightingTimestamp(s); ts != 0 {
+		data["timestamp"] = ts
+	}
+	return data, nil
+}
+
+// Contexts of ListSightings and SearchSightings
+const (
+	SightingContextAttribute = "attribute"
+	SightingContextEvent     = "event"
+)
+
+// ListSightings lists the sightings of the attribute or event id, target
+// being SightingContextAttribute or SightingContextEvent
+func (client *Client) ListSightings(target string, id string) ([]Sighting, error) {
+	return client.ListSightingsContext(context.Background(), target, id)
+}
+
+// ListSightingsContext is like ListSightings but honors ctx
+func (client *Client) ListSightingsContext(ctx context.Context, target string, id string) ([]Sighting, error) {
+	path := fmt.Sprintf("/sightings/listSightings/%s/%s", id, target)
+	// listing does not modify anything, it can be replayed
+	return client.readSightings(RetrySafe(ctx), path, nil)
+}
+
+// Delete a sighting
+func (client *Client) DeleteSighting(id string) (*Response, error) {
+	return client.DeleteSightingContext(context.Background(), id)
+}
+
+// DeleteSightingContext is like DeleteSighting but honors ctx
+func (client *Client) DeleteSightingContext(ctx context.Context, id string) (*Response, error) {
+	return client.postResponse(ctx, "/sightings/delete/"+id, nil)
+}
+
+// SightingSearch is a /sightings/restSearch request
+type SightingSearch struct {
+	// Context is SightingContextAttribute or SightingContextEvent, ID then
+	// being the attribute or event ID. Empty searches every sighting.
+	Context string       `json:"-"`
+	ID      string       `json:"id,omitempty"`
+	Type    SightingType `json:"type,omitempty"`
+	Source  string       `json:"source,omitempty"`
+	OrgID   string       `json:"org_id,omitempty"`
+	// From and To are dates or Unix timestamps
+	From string `json:"date_from,omitempty"`
+	To   string `json:"date_to,omitempty"`
+	// Last is a relative time such as "7d"
+	Last             string `json:"last,omitempty"`
+	IncludeAttribute bool   `json:"includeAttribute,omitempty"`
+	IncludeEvent     bool   `json:"includeEvent,omitempty"`
+}
+
+// Search the sightings of the MISP instance
+func (client *Client) SearchSightings(search *SightingSearch) ([]Sighting, error) {
+	return client.SearchSightingsContext(context.Background(), search)
+}
+
+// SearchSightingsContext is like SearchSightings but honors ctx
+func (client *Client) SearchSightingsContext(ctx context.Context, search *SightingSearch) ([]Sighting, error) {
+	path := "/sightings/restSearch"
+	if search.Context != "" {
+		path += "/" + search.Context
+	}
+	// restSearch does not modify anything, it can be replayed
+	return client.readSightings(RetrySafe(ctx), path, search)
+}
+
+// readSightings posts req to path and decodes the [{"Sighting": {...}}]
+// reply
+func (client *Client) readSightings(ctx context.Context, path string, req interface{}) ([]Sighting, error) {
+	var result []struct {
+		Sighting Sighting `json:"Sighting"`
+	}
+
+	resp, err := client.PostContext(ctx, path, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	sightings := make([]Sighting, 0, len(result))
+	for _, item := range result {
+		sightings = append(sightings, item.Sighting)
+	}
+	return sightings, nil
+}
@@ -0,0 +1,111 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// StreamEvents runs an /events/restSearch and calls fn for every event as
+// soon as it is decoded, so memory use does not grow with the size of the
+// reply. An error returned by fn stops the stream and is returned as is.
+func (client *Client) StreamEvents(ctx context.Context, search *Search, fn func(Event) error) error {
+	body, err := client.searchBody(ctx, "events", search, "application/json")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	return streamArray(dec, []string{"response"}, func() error {
+		var item map[string]Event
+		if err := dec.Decode(&item); err != nil {
+			return err
+		}
+		return fn(item["Event"])
+	})
+}
+
+// StreamAttributes runs an /attributes/restSearch and calls fn for every
+// attribute as soon as it is decoded, see StreamEvents
+func (client *Client) StreamAttributes(ctx context.Context, search *Search, fn func(Attribute) error) error {
+	body, err := client.searchBody(ctx, "attributes", search, "application/json")
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	dec := json.NewDecoder(body)
+	return streamArray(dec, []string{"response", "Attribute"}, func() error {
+		var attr Attribute
+		if err := dec.Decode(&attr); err != nil {
+			return err
+		}
+		return fn(attr)
+	})
+}
+
+// streamArray walks dec down the object keys of path and calls decode for
+// every element of the array found there, decode reading it from dec. MISP
+// replies with an empty array instead of an object when nothing matched.
+func streamArray(dec *json.Decoder, path []string, decode func() error) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return streamError(err)
+	}
+
+	switch tok {
+	case nil:
+		return nil
+	case json.Delim('['):
+		for dec.More() {
+			if len(path) > 0 {
+				// the empty array standing for an object
+				var skip json.RawMessage
+				if err = dec.Decode(&skip); err != nil {
+					return streamError(err)
+				}
+				continue
+			}
+			if err = decode(); err != nil {
+				return err
+			}
+		}
+	case json.Delim('{'):
+		if len(path) == 0 {
+			return fmt.Errorf("Could not unmarshal response: expected an array")
+		}
+		for dec.More() {
+			key, err := dec.Token()
+			if err != nil {
+				return streamError(err)
+			}
+			if key == path[0] {
+				if err = streamArray(dec, path[1:], decode); err != nil {
+					return err
+				}
+				continue
+			}
+			var skip json.RawMessage
+			if err = dec.Decode(&skip); err != nil {
+				return streamError(err)
+			}
+		}
+	default:
+		return fmt.Errorf("Could not unmarshal response: unexpected %v", tok)
+	}
+
+	// closing delimiter
+	if _, err = dec.Token(); err != nil {
+		return streamError(err)
+	}
+	return nil
+}
+
+func streamError(err error) error {
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return err
+}
@@ -2,7 +2,7 @@ package misp
 
 import (
 	"encoding/json"
-	"strconv"
+	"net/http"
 	"time"
 
 	"github.com/google/uuid"
@@ -10,11 +10,23 @@ import (
 
 // Sighting ... XXX
 type Sighting struct {
-	ID        string   `json:"id,omitempty"`
-	UUID      string   `json:"uuid,omitempty"`
-	Value     string   `json:"value,omitempty"`
-	Values    []string `json:"values,omitempty"`
-	Timestamp int      `json:"timestamp,omitempty"`
+	ID        FlexString `json:"id,omitempty"`
+	UUID      string     `json:"uuid,omitempty"`
+	Value     string     `json:"value,omitempty"`
+	Values    []string   `json:"values,omitempty"`
+	Timestamp int        `json:"timestamp,omitempty"`
+	// Type defaults to SightingTypeSighting
+	Type   SightingType `json:"type,omitempty"`
+	Source string       `json:"source,omitempty"`
+	OrgID  FlexString   `json:"org_id,omitempty"`
+	// DateSighting is when the value was seen, sent as the timestamp of new
+	// sightings when Timestamp is not set
+	DateSighting  UnixTime   `json:"date_sighting"`
+	AttributeID   FlexString `json:"attribute_id,omitempty"`
+	AttributeUUID string     `json:"attribute_uuid,omitempty"`
+	EventID       FlexString `json:"event_id,omitempty"`
+	Attribute     *Attribute `json:"Attribute,omitempty"`
+	Event         *Event     `json:"Event,omitempty"`
 }
 
 // Request ... XXX
@@ -31,11 +43,11 @@ type SampleFile struct {
 // SampleUpload ... XXX
 type SampleUpload struct {
 	Files        []SampleFile `json:"files,omitempty"`
-	Distribution string       `json:"distribution,omitempty"`
+	Distribution Distribution `json:"distribution,omitempty"`
 	Comment      string       `json:"comment,omitempty"` // comment field of any attribute created
 	EventID      string       `json:"event_id,omitempty"`
 	ToIDS        bool         `json:"to_ids,omitempty"`
-	Category     string       `json:"category,omitempty"`
+	Category     Category     `json:"category,omitempty"`
 	Info         string       `json:"info,omitempty"` // event info field if no event ID supplied
 }
 
@@ -50,6 +62,32 @@ type XResponse struct {
 
 // Response is the outer layer of each MISP response
 type Response struct {
+	Name    string     `json:"name,omitempty"`
+	Message string     `json:"message,omitempty"`
+	URL     string     `json:"url,omitempty"`
+	Saved   bool       `json:"saved,omitempty"`
+	Success FlexString `json:"success,omitempty"`
+	// Errors is sent by MISP as a string, a list or an object, see APIError
+	Errors json.RawMessage `json:"errors,omitempty"`
+}
+
+// err returns an APIError when MISP reported errors along a 200 reply
+func (r *Response) err(res *http.Response) error {
+	apiErr := &APIError{
+		StatusCode: res.StatusCode,
+		Name:       r.Name,
+		Message:    r.Message,
+		URL:        r.URL,
+	}
+	if res.Request != nil {
+		apiErr.Method = res.Request.Method
+		apiErr.Path = res.Request.URL.Path
+	}
+	apiErr.parseErrors("", r.Errors)
+	if len(apiErr.Errors) == 0 && len(apiErr.ValidationErrors) == 0 {
+		return nil
+	}
+	return apiErr
 }
 
 type searchOuterResponse struct {
@@ -62,126 +100,157 @@ type searchInnerResponse struct {
 }
 
 type Attribute struct {
-	ID                 string `json:"id"`
-	EventID            string `json:"event_id"`
-	ObjectID           string `json:"object_id"`
-	ObjectRelation     string `json:"object_relation"`
-	Category           string `json:"category"`
-	Type               string `json:"type"`
-	Value              string `json:"value"`
-	ToIDS              bool   `json:"to_ids"`
-	UUID               string `json:"uuid"`
-	Timestamp          string `json:"timestamp"`
-	Distribution       string `json:"distribution"`
-	SharingGroupID     string `json:"sharing_group_id"`
-	Comment            string `json:"comment"`
-	Deleted            bool   `json:"deleted"`
-	DisableCorrelation bool   `json:"disable_correlation"`
-	FirstSeen          string `json:"first_seen"`
-	LastSeen           string `json:"last_seen"`
+	ID                 FlexString   `json:"id"`
+	EventID            FlexString   `json:"event_id"`
+	ObjectID           FlexString   `json:"object_id"`
+	ObjectRelation     string       `json:"object_relation"`
+	Category           Category     `json:"category"`
+	Type               string       `json:"type"`
+	Value              string       `json:"value"`
+	ToIDS              FlexBool     `json:"to_ids"`
+	UUID               string       `json:"uuid"`
+	Timestamp          UnixTime     `json:"timestamp"`
+	Distribution       Distribution `json:"distribution"`
+	SharingGroupID     FlexString   `json:"sharing_group_id"`
+	Comment            string       `json:"comment"`
+	Deleted            FlexBool     `json:"deleted"`
+	DisableCorrelation FlexBool     `json:"disable_correlation"`
+	FirstSeen          SeenTime     `json:"first_seen"`
+	LastSeen           SeenTime     `json:"last_seen"`
 }
 
 func NewAttribute() Attribute {
 	return Attribute{
 		Comment:   "",
 		UUID:      uuid.NewString(),
-		Timestamp: strconv.FormatInt(time.Now().Unix(), 10),
+		Timestamp: NewUnixTime(time.Now()),
 	}
 }
 
 type ShadowAttribute struct {
-	ID                 string `json:"id"`
-	EventID            string `json:"event_id"`
-	ObjectID           string `json:"object_id"`
-	ObjectRelation     string `json:"object_relation"`
-	Category           string `json:"category"`
-	Type               string `json:"type"`
-	Value              string `json:"value"`
-	ToIds              bool   `json:"to_ids"`
-	UUID               string `json:"uuid"`
-	Timestamp          string `json:"timestamp"`
-	Distribution       string `json:"distribution"`
-	SharingGroupID     string `json:"sharing_group_id"`
-	Comment            string `json:"comment"`
-	Deleted            bool   `json:"deleted"`
-	DisableCorrelation bool   `json:"disable_correlation"`
-	FirstSeen          string `json:"first_seen"`
-	LastSeen           string `json:"last_seen"`
+	ID                 FlexString   `json:"id"`
+	EventID            FlexString   `json:"event_id"`
+	ObjectID           FlexString   `json:"object_id"`
+	ObjectRelation     string       `json:"object_relation"`
+	Category           Category     `json:"category"`
+	Type               string       `json:"type"`
+	Value              string       `json:"value"`
+	ToIds              FlexBool     `json:"to_ids"`
+	UUID               string       `json:"uuid"`
+	Timestamp          UnixTime     `json:"timestamp"`
+	Distribution       Distribution `json:"distribution"`
+	SharingGroupID     FlexString   `json:"sharing_group_id"`
+	Comment            string       `json:"comment"`
+	Deleted            FlexBool     `json:"deleted"`
+	DisableCorrelation FlexBool     `json:"disable_correlation"`
+	FirstSeen          SeenTime     `json:"first_seen"`
+	LastSeen           SeenTime     `json:"last_seen"`
+	// OldID is the attribute a proposal edits or deletes, "0" for a new
+	// attribute
+	OldID            FlexString `json:"old_id"`
+	ProposalToDelete FlexBool   `json:"proposal_to_delete"`
+	OrgID            FlexString `json:"org_id"`
+	EventOrgID       FlexString `json:"event_org_id"`
+	EventUUID        string     `json:"event_uuid"`
+	Email            string     `json:"email"`
 }
 
 type Galaxy struct {
-	ID             string `json:"id"`
-	UUID           string `json:"uuid"`
-	Name           string `json:"name"`
-	Type           string `json:"type"`
-	Description    string `json:"description"`
-	Version        string `json:"version"`
-	Icon           string `json:"icon"`
-	Namespace      string `json:"namespace"`
-	KillChainOrder struct {
-		FraudTactics []string `json:"fraud-tactics"`
-	} `json:"kill_chain_order"`
+	ID          FlexString `json:"id"`
+	UUID        string     `json:"uuid"`
+	Name        string     `json:"name"`
+	Type        string     `json:"type"`
+	Description string     `json:"description"`
+	Version     FlexString `json:"version"`
+	Icon        string     `json:"icon"`
+	Namespace   string     `json:"namespace"`
+	Enabled     FlexBool   `json:"enabled"`
+	LocalOnly   FlexBool   `json:"local_only"`
+	// KillChainOrder maps each kill chain of the galaxy, such as
+	// mitre-attack, to its ordered phases
+	KillChainOrder KillChainOrder `json:"kill_chain_order,omitempty"`
+	// GalaxyCluster holds the clusters attached to an event or attribute
+	GalaxyCluster []GalaxyCluster `json:"GalaxyCluster,omitempty"`
 }
 
 type Object struct {
-	ID              string      `json:"id"`
-	Name            string      `json:"name"`
-	MetaCategory    string      `json:"meta-category"`
-	Description     string      `json:"description"`
-	TemplateUUID    string      `json:"template_uuid"`
-	TemplateVersion string      `json:"template_version"`
-	EventID         string      `json:"event_id"`
-	UUID            string      `json:"uuid"`
-	Timestamp       string      `json:"timestamp"`
-	Distribution    string      `json:"distribution"`
-	SharingGroupID  string      `json:"sharing_group_id"`
-	Comment         string      `json:"comment"`
-	Deleted         bool        `json:"deleted"`
-	FirstSeen       string      `json:"first_seen"`
-	LastSeen        string      `json:"last_seen"`
-	Attribute       []Attribute `json:"Attribute"`
+	ID              FlexString        `json:"id"`
+	Name            string            `json:"name"`
+	MetaCategory    string            `json:"meta-category"`
+	Description     string            `json:"description"`
+	TemplateUUID    string            `json:"template_uuid"`
+	TemplateVersion FlexString        `json:"template_version"`
+	EventID         FlexString        `json:"event_id"`
+	UUID            string            `json:"uuid"`
+	Timestamp       UnixTime          `json:"timestamp"`
+	Distribution    Distribution      `json:"distribution"`
+	SharingGroupID  FlexString        `json:"sharing_group_id"`
+	Comment         string            `json:"comment"`
+	Deleted         FlexBool          `json:"deleted"`
+	FirstSeen       SeenTime          `json:"first_seen"`
+	LastSeen        SeenTime          `json:"last_seen"`
+	Attribute       []Attribute       `json:"Attribute"`
+	ObjectReference []ObjectReference `json:"ObjectReference,omitempty"`
+}
+
+// ObjectReference links an object to another object or attribute
+type ObjectReference struct {
+	ID               FlexString `json:"id"`
+	UUID             string     `json:"uuid"`
+	Timestamp        UnixTime   `json:"timestamp"`
+	ObjectID         FlexString `json:"object_id"`
+	EventID          FlexString `json:"event_id"`
+	SourceUUID       string     `json:"source_uuid"`
+	ReferencedUUID   string     `json:"referenced_uuid"`
+	ReferencedID     FlexString `json:"referenced_id"`
+	ReferencedType   FlexString `json:"referenced_type"`
+	RelationshipType string     `json:"relationship_type"`
+	Comment          string     `json:"comment"`
+	Deleted          FlexBool   `json:"deleted"`
+	ObjectUUID       string     `json:"object_uuid"`
 }
 
 type Tag struct {
-	ID             string `json:"id"`
-	Name           string `json:"name"`
-	Colour         string `json:"colour"`
-	Exportable     bool   `json:"exportable"`
-	OrgID          string `json:"org_id"`
-	UserID         string `json:"user_id"`
-	HideTag        bool   `json:"hide_tag"`
-	NumericalValue string `json:"numerical_value"`
-	IsGalaxy       bool   `json:"is_galaxy"`
-	IsCustomGalaxy bool   `json:"is_custom_galaxy"`
-	Inherited      int    `json:"inherited"`
+	ID             FlexString `json:"id"`
+	Name           string     `json:"name"`
+	Colour         string     `json:"colour"`
+	Exportable     FlexBool   `json:"exportable"`
+	OrgID          FlexString `json:"org_id"`
+	UserID         FlexString `json:"user_id"`
+	HideTag        FlexBool   `json:"hide_tag"`
+	NumericalValue FlexString `json:"numerical_value"`
+	IsGalaxy       FlexBool   `json:"is_galaxy"`
+	IsCustomGalaxy FlexBool   `json:"is_custom_galaxy"`
+	Inherited      FlexInt    `json:"inherited"`
 }
 
 type Feed struct {
-	ID              string `json:"id"`
-	Name            string `json:"name"`
-	Provider        string `json:"provider"`
-	URL             string `json:"url"`
-	Rules           string `json:"rules"`
-	Enabled         bool   `json:"enabled"`
-	Distribution    string `json:"distribution"`
-	SharingGroupID  string `json:"sharing_group_id"`
-	TagID           string `json:"tag_id"`
-	Default         bool   `json:"default"`
-	SourceFormat    string `json:"source_format"`
-	FixedEvent      bool   `json:"fixed_event"`
-	DeltaMerge      bool   `json:"delta_merge"`
-	EventID         string `json:"event_id"`
-	Publish         bool   `json:"publish"`
-	OverrideIds     bool   `json:"override_ids"`
-	Settings        string `json:"settings"`
-	InputSource     string `json:"input_source"`
-	DeleteLocalFile bool   `json:"delete_local_file"`
-	LookupVisible   bool   `json:"lookup_visible"`
-	Headers         string `json:"headers"`
-	CachingEnabled  bool   `json:"caching_enabled"`
-	ForceToIds      bool   `json:"force_to_ids"`
-	OrgcID          string `json:"orgc_id"`
-	CacheTimestamp  string `json:"cache_timestamp"`
+	ID              FlexString   `json:"id"`
+	Name            string       `json:"name"`
+	Provider        string       `json:"provider"`
+	URL             string       `json:"url"`
+	Rules           string       `json:"rules"`
+	Enabled         FlexBool     `json:"enabled"`
+	Distribution    Distribution `json:"distribution"`
+	SharingGroupID  FlexString   `json:"sharing_group_id"`
+	TagID           FlexString   `json:"tag_id"`
+	Default         FlexBool     `json:"default"`
+	SourceFormat    FlexString   `json:"source_format"`
+	FixedEvent      FlexBool     `json:"fixed_event"`
+	DeltaMerge      FlexBool     `json:"delta_merge"`
+	EventID         FlexString   `json:"event_id"`
+	Publish         FlexBool     `json:"publish"`
+	OverrideIds     FlexBool     `json:"override_ids"`
+	Settings        string       `json:"settings"`
+	InputSource     string       `json:"input_source"`
+	DeleteLocalFile FlexBool     `json:"delete_local_file"`
+	LookupVisible   FlexBool     `json:"lookup_visible"`
+	Headers         string       `json:"headers"`
+	CachingEnabled  FlexBool     `json:"caching_enabled"`
+	ForceToIds      FlexBool     `json:"force_to_ids"`
+	OrgcID          FlexString   `json:"orgc_id"`
+	// CacheTimestamp is "false" when the feed was never cached
+	CacheTimestamp FlexString `json:"cache_timestamp"`
 }
 
 func ToMap(src interface{}) (r map[string]interface{}, err error) {
@@ -0,0 +1,207 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+// List every tag of the MISP instance
+func (client *Client) ListTags() ([]Tag, error) {
+	return client.ListTagsContext(context.Background())
+}
+
+// ListTagsContext is like ListTags but honors ctx
+func (client *Client) ListTagsContext(ctx context.Context) ([]Tag, error) {
+	var result struct {
+		Tag []Tag `json:"Tag"`
+	}
+
+	resp, err := client.GetContext(ctx, "/tags/index", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+	return result.Tag, nil
+}
+
+// Get a tag by ID
+func (client *Client) GetTag(id string) (Tag, error) {
+	return client.GetTagContext(context.Background(), id)
+}
+
+// GetTagContext is like GetTag but honors ctx
+func (client *Client) GetTagContext(ctx context.Context, id string) (Tag, error) {
+	resp, err := client.GetContext(ctx, "/tags/view/"+id, nil)
+	if err != nil {
+		return Tag{}, err
+	}
+	return readTag(resp)
+}
+
+// SearchTags returns the tags named name, or containing name unless strict
+// is set
+func (client *Client) SearchTags(name string, strict bool) ([]Tag, error) {
+	return client.SearchTagsContext(context.Background(), name, strict)
+}
+
+// SearchTagsContext is like SearchTags but honors ctx
+func (client *Client) SearchTagsContext(ctx context.Context, name string, strict bool) ([]Tag, error) {
+	var result []struct {
+		Tag Tag `json:"Tag"`
+	}
+
+	if !strict {
+		name = "%" + name + "%"
+	}
+	resp, err := client.GetContext(ctx, "/tags/search/"+name, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	tags := make([]Tag, 0, len(result))
+	for _, item := range result {
+		tags = append(tags, item.Tag)
+	}
+	return tags, nil
+}
+
+// Add a new tag
+func (client *Client) AddTag(tag Tag) (Tag, error) {
+	return client.AddTagContext(context.Background(), tag)
+}
+
+// AddTagContext is like AddTag but honors ctx
+func (client *Client) AddTagContext(ctx context.Context, tag Tag) (Tag, error) {
+	data, err := tagData(tag)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	resp, err := client.PostContext(ctx, "/tags/add", data)
+	if err != nil {
+		return Tag{}, err
+	}
+	return readTag(resp)
+}
+
+// UpdateTag edits the name, colour, exportable, hide_tag and numerical_value
+// of an existing tag, identified by its ID
+func (client *Client) UpdateTag(tag Tag) (Tag, error) {
+	return client.UpdateTagContext(context.Background(), tag)
+}
+
+// UpdateTagContext is like UpdateTag but honors ctx
+func (client *Client) UpdateTagContext(ctx context.Context, tag Tag) (Tag, error) {
+	if tag.ID == "" {
+		return Tag{}, fmt.Errorf("UpdateTag(): tag has no ID")
+	}
+
+	data, err := tagData(tag)
+	if err != nil {
+		return Tag{}, err
+	}
+
+	resp, err := client.PostContext(ctx, "/tags/edit/"+string(tag.ID), data)
+	if err != nil {
+		return Tag{}, err
+	}
+	return readTag(resp)
+}
+
+// Delete a tag, removing it from everything it is attached to
+func (client *Client) DeleteTag(id string) (*Response, error) {
+	return client.DeleteTagContext(context.Background(), id)
+}
+
+// DeleteTagContext is like DeleteTag but honors ctx
+func (client *Client) DeleteTagContext(ctx context.Context, id string) (*Response, error) {
+	return client.postResponse(ctx, "/tags/delete/"+id, nil)
+}
+
+type tagObjectRequest struct {
+	UUID  string `json:"uuid"`
+	Tag   string `json:"tag"`
+	Local bool   `json:"local,omitempty"`
+}
+
+// AttachTag tags the event, attribute or object identified by uuid with the
+// tag named tag. A local tag is not synchronised to other instances.
+func (client *Client) AttachTag(uuid string, tag string, local bool) (*Response, error) {
+	return client.AttachTagContext(context.Background(), uuid, tag, local)
+}
+
+// AttachTagContext is like AttachTag but honors ctx
+func (client *Client) AttachTagContext(ctx context.Context, uuid string, tag string, local bool) (*Response, error) {
+	req := tagObjectRequest{UUID: uuid, Tag: tag, Local: local}
+	return client.postResponse(ctx, "/tags/attachTagToObject", req)
+}
+
+// DetachTag removes the tag named tag from the event, attribute or object
+// identified by uuid
+func (client *Client) DetachTag(uuid string, tag string) (*Response, error) {
+	return client.DetachTagContext(context.Background(), uuid, tag)
+}
+
+// DetachTagContext is like DetachTag but honors ctx
+func (client *Client) DetachTagContext(ctx context.Context, uuid string, tag string) (*Response, error) {
+	req := tagObjectRequest{UUID: uuid, Tag: tag}
+	return client.postResponse(ctx, "/tags/removeTagFromObject", req)
+}
+
+// tagData turns tag into the payload expected by /tags/add and /tags/edit,
+// without the elements MISP sets by itself
+func tagData(tag Tag) (map[string]interface{}, error) {
+	data, err := ToMap(tag)
+	if err != nil {
+		return nil, err
+	}
+	elem := []string{
+		"id",
+		"org_id",
+		"user_id",
+		"is_galaxy",
+		"is_custom_galaxy",
+		"inherited",
+	}
+	for _, item := range elem {
+		delete(data, item)
+	}
+	if tag.NumericalValue == "" {
+		delete(data, "numerical_value")
+	}
+	return data, nil
+}
+
+// readTag decodes a tag reply, wrapped in {"Tag": {...}} or not, and closes
+// its body
+func readTag(resp *http.Response) (tag Tag, err error) {
+	var result map[string]json.RawMessage
+
+	defer resp.Body.Close()
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return tag, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	raw, ok := result["Tag"]
+	if !ok {
+		raw, _ = json.Marshal(result)
+	}
+	if err = json.Unmarshal(raw, &tag); err != nil {
+		return tag, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+	return tag, nil
+}
@@ -0,0 +1,312 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Taxonomy is a tag vocabulary, as found in the machinetag.json files of the
+// misp-taxonomies repository or listed by the MISP instance
+type Taxonomy struct {
+	ID          FlexString `json:"id,omitempty"`
+	Namespace   string     `json:"namespace"`
+	Description string     `json:"description"`
+	Version     FlexInt    `json:"version"`
+	Enabled     FlexBool   `json:"enabled,omitempty"`
+	// Exclusive allows a single tag of the namespace on an event or attribute
+	Exclusive  FlexBool            `json:"exclusive,omitempty"`
+	Required   FlexBool            `json:"required,omitempty"`
+	Predicates []TaxonomyPredicate `json:"predicates,omitempty"`
+	Values     []TaxonomyValues    `json:"values,omitempty"`
+	// Entries lists the tags of the taxonomy, only set by GetTaxonomy
+	Entries []TaxonomyEntry `json:"-"`
+}
+
+// TaxonomyPredicate is a predicate of a taxonomy
+type TaxonomyPredicate struct {
+	Value       string `json:"value"`
+	Expanded    string `json:"expanded,omitempty"`
+	Description string `json:"description,omitempty"`
+	Colour      string `json:"colour,omitempty"`
+	// Exclusive allows a single value of the predicate
+	Exclusive      FlexBool `json:"exclusive,omitempty"`
+	NumericalValue float64  `json:"numerical_value,omitempty"`
+}
+
+// TaxonomyValues lists the values allowed for a predicate
+type TaxonomyValues struct {
+	Predicate string              `json:"predicate"`
+	Entry     []TaxonomyPredicate `json:"entry"`
+}
+
+// TaxonomyEntry is a tag of a taxonomy as shown by the MISP instance
+type TaxonomyEntry struct {
+	Tag                string   `json:"tag"`
+	Expanded           string   `json:"expanded"`
+	Description        string   `json:"description"`
+	ExclusivePredicate FlexBool `json:"exclusive_predicate"`
+}
+
+// List the taxonomies known to the MISP instance, enabled or not
+func (client *Client) ListTaxonomies() ([]Taxonomy, error) {
+	return client.ListTaxonomiesContext(context.Background())
+}
+
+// ListTaxonomiesContext is like ListTaxonomies but honors ctx
+func (client *Client) ListTaxonomiesContext(ctx context.Context) ([]Taxonomy, error) {
+	var result []struct {
+		Taxonomy Taxonomy `json:"Taxonomy"`
+	}
+
+	resp, err := client.GetContext(ctx, "/taxonomies/index", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return nil, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	taxonomies := make([]Taxonomy, 0, len(result))
+	for _, item := range result {
+		taxonomies = append(taxonomies, item.Taxonomy)
+	}
+	return taxonomies, nil
+}
+
+// Get a taxonomy by ID, along with its tags
+func (client *Client) GetTaxonomy(id string) (Taxonomy, error) {
+	return client.GetTaxonomyContext(context.Background(), id)
+}
+
+// GetTaxonomyContext is like GetTaxonomy but honors ctx
+func (client *Client) GetTaxonomyContext(ctx context.Context, id string) (Taxonomy, error) {
+	var result struct {
+		Taxonomy Taxonomy        `json:"Taxonomy"`
+		Entries  []TaxonomyEntry `json:"entries"`
+	}
+
+	resp, err := client.GetContext(ctx, "/taxonomies/view/"+id, nil)
+	if err != nil {
+		return Taxonomy{}, err
+	}
+	defer resp.Body.Close()
+
+	decoder := json.NewDecoder(resp.Body)
+	if err = decoder.Decode(&result); err != nil {
+		return Taxonomy{}, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+	result.Taxonomy.Entries = result.Entries
+	return result.Taxonomy, nil
+}
+
+// Enable a taxonomy, making its tags available
+func (client *Client) EnableTaxonomy(id string) (*Response, error) {
+	return client.EnableTaxonomyContext(context.Background(), id)
+}
+
+// EnableTaxonomyContext is like EnableTaxonomy but honors ctx
+func (client *Client) EnableTaxonomyContext(ctx context.Context, id string) (*Response, error) {
+	return client.postResponse(ctx, "/taxonomies/enable/"+id, nil)
+}
+
+// Disable a taxonomy
+func (client *Client) DisableTaxonomy(id string) (*Response, error) {
+	return client.DisableTaxonomyContext(context.Background(), id)
+}
+
+// DisableTaxonomyContext is like DisableTaxonomy but honors ctx
+func (client *Client) DisableTaxonomyContext(ctx context.Context, id string) (*Response, error) {
+	return client.postResponse(ctx, "/taxonomies/disable/"+id, nil)
+}
+
+// predicate returns the predicate named value
+func (t Taxonomy) predicate(value string) (TaxonomyPredicate, bool) {
+	for _, p := range t.Predicates {
+		if p.Value == value {
+			return p, true
+		}
+	}
+	return TaxonomyPredicate{}, false
+}
+
+// values returns the values allowed for predicate, nil when the predicate
+// takes no value
+func (t Taxonomy) values(predicate string) []string {
+	var values []string
+	for _, v := range t.Values {
+		if v.Predicate != predicate {
+			continue
+		}
+		for _, entry := range v.Entry {
+			values = append(values, entry.Value)
+		}
+	}
+	return values
+}
+
+// TagValidationError lists everything wrong with a set of tags
+type TagValidationError struct {
+	Problems []string
+}
+
+func (e *TagValidationError) Error() string {
+	return fmt.Sprintf("invalid tags: %s", strings.Join(e.Problems, "; "))
+}
+
+// TaxonomyRegistry holds taxonomies, indexed by namespace. It is safe for
+// concurrent use.
+type TaxonomyRegistry struct {
+	mu         sync.RWMutex
+	taxonomies map[string]*Taxonomy
+}
+
+// NewTaxonomyRegistry returns an empty registry
+func NewTaxonomyRegistry() *TaxonomyRegistry {
+	return &TaxonomyRegistry{
+		taxonomies: make(map[string]*Taxonomy),
+	}
+}
+
+// Add registers t, replacing any taxonomy with the same namespace
+func (r *TaxonomyRegistry) Add(t Taxonomy) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.taxonomies[t.Namespace] = &t
+}
+
+// Get returns the taxonomy of the namespace
+func (r *TaxonomyRegistry) Get(namespace string) (Taxonomy, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.taxonomies[namespace]
+	if !ok {
+		return Taxonomy{}, false
+	}
+	return *t, true
+}
+
+// Namespaces returns the sorted namespaces of the registered taxonomies
+func (r *TaxonomyRegistry) Namespaces() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	namespaces := make([]string, 0, len(r.taxonomies))
+	for namespace := range r.taxonomies {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+	return namespaces
+}
+
+// LoadDir registers every machinetag.json found below dir, typically a
+// misp-taxonomies checkout
+func (r *TaxonomyRegistry) LoadDir(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != "machinetag.json" {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var t Taxonomy
+		if err = json.Unmarshal(data, &t); err != nil {
+			return fmt.Errorf("Could not parse %s: %s", path, err)
+		}
+		r.Add(t)
+		return nil
+	})
+}
+
+// Validate checks that tags can be set together on an event or attribute.
+// Tags out of the registered taxonomies are not checked. It returns a
+// *TagValidationError listing every problem.
+func (r *TaxonomyRegistry) Validate(tags []string) error {
+	var problems []string
+
+	seen := make(map[string]bool, len(tags))
+	// tags set per namespace and per namespace:predicate
+	inNamespace := make(map[string][]string)
+	inPredicate := make(map[string][]string)
+	for _, name := range tags {
+		if seen[name] {
+			continue
+		}
+		seen[name] = true
+
+		mt, err := ParseMachineTag(name)
+		if err != nil {
+			continue
+		}
+		t, ok := r.Get(mt.Namespace)
+		if !ok {
+			continue
+		}
+
+		values := t.values(mt.Predicate)
+		p, ok := t.predicate(mt.Predicate)
+		switch {
+		case !ok && values == nil:
+			problems = append(problems, fmt.Sprintf("%s: unknown predicate %q", name, mt.Predicate))
+			continue
+		case values == nil && mt.Value != "":
+			problems = append(problems, fmt.Sprintf("%s: predicate %q takes no value", name, mt.Predicate))
+			continue
+		case values != nil && !contains(values, mt.Value):
+			problems = append(problems, fmt.Sprintf("%s: value %q not in %v", name, mt.Value, values))
+			continue
+		}
+
+		if t.Exclusive {
+			inNamespace[mt.Namespace] = append(inNamespace[mt.Namespace], name)
+		}
+		if p.Exclusive {
+			key := mt.Namespace + ":" + mt.Predicate
+			inPredicate[key] = append(inPredicate[key], name)
+		}
+	}
+
+	for _, exclusive := range []map[string][]string{inNamespace, inPredicate} {
+		keys := make([]string, 0, len(exclusive))
+		for key := range exclusive {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			if names := exclusive[key]; len(names) > 1 {
+				problems = append(problems, fmt.Sprintf("%s is exclusive: %s", key, strings.Join(names, ", ")))
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return &TagValidationError{Problems: problems}
+	}
+	return nil
+}
+
+// CanAttach checks that tag can be added to an event or attribute carrying
+// existing, see Validate
+func (r *TaxonomyRegistry) CanAttach(existing []Tag, tag string) error {
+	names := make([]string, 0, len(existing)+1)
+	for _, t := range existing {
+		names = append(names, t.Name)
+	}
+	return r.Validate(append(names, tag))
+}
@@ -0,0 +1,367 @@
+package misp
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// ObjectTemplate describes the attributes a MISP object is made of, as found
+// in the definition.json files of the misp-objects repository
+type ObjectTemplate struct {
+	UUID          string                             `json:"uuid"`
+	Name          string                             `json:"name"`
+	Description   string                             `json:"description"`
+	MetaCategory  string                             `json:"meta-category"`
+	Version       int                                `json:"version"`
+	Required      []string                           `json:"required,omitempty"`
+	RequiredOneOf []string                           `json:"requiredOneOf,omitempty"`
+	Attributes    map[string]ObjectTemplateAttribute `json:"attributes"`
+}
+
+// ObjectTemplateAttribute describes one object relation of a template
+type ObjectTemplateAttribute struct {
+	MISPAttribute      string   `json:"misp-attribute"`
+	Description        string   `json:"description"`
+	UIPriority         int      `json:"ui-priority"`
+	Multiple           bool     `json:"multiple,omitempty"`
+	DisableCorrelation bool     `json:"disable_correlation,omitempty"`
+	ToIDS              bool     `json:"to_ids,omitempty"`
+	Categories         []string `json:"categories,omitempty"`
+	SaneDefault        []string `json:"sane_default,omitempty"`
+	ValuesList         []string `json:"values_list,omitempty"`
+}
+
+// ObjectValidationError lists everything wrong with an object
+type ObjectValidationError struct {
+	Object   string
+	Problems []string
+}
+
+func (e *ObjectValidationError) Error() string {
+	return fmt.Sprintf("invalid %s object: %s", e.Object, strings.Join(e.Problems, "; "))
+}
+
+// TemplateRegistry holds object templates, indexed by name and UUID. It is
+// safe for concurrent use.
+type TemplateRegistry struct {
+	mu        sync.RWMutex
+	templates map[string]*ObjectTemplate
+}
+
+// NewTemplateRegistry returns an empty registry
+func NewTemplateRegistry() *TemplateRegistry {
+	return &TemplateRegistry{
+		templates: make(map[string]*ObjectTemplate),
+	}
+}
+
+// Add registers t, replacing any template with the same name or UUID
+func (r *TemplateRegistry) Add(t ObjectTemplate) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.templates[t.Name] = &t
+	if t.UUID != "" {
+		r.templates[t.UUID] = &t
+	}
+}
+
+// Get returns the template with the given name or UUID
+func (r *TemplateRegistry) Get(nameOrUUID string) (ObjectTemplate, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.templates[nameOrUUID]
+	if !ok {
+		return ObjectTemplate{}, false
+	}
+	return *t, true
+}
+
+// Names returns the sorted names of the registered templates
+func (r *TemplateRegistry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.templates))
+	for key, t := range r.templates {
+		if key == t.Name {
+			names = append(names, key)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadDir registers every definition.json found below dir, typically the
+// objects directory of a misp-objects checkout
+func (r *TemplateRegistry) LoadDir(dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name() != "definition.json" {
+			return nil
+		}
+
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		var t ObjectTemplate
+		if err = json.Unmarshal(data, &t); err != nil {
+			return fmt.Errorf("Could not parse %s: %s", path, err)
+		}
+		r.Add(t)
+		return nil
+	})
+}
+
+type serverTemplate struct {
+	ObjectTemplate struct {
+		ID           FlexString `json:"id"`
+		UUID         string     `json:"uuid"`
+		Name         string     `json:"name"`
+		Description  string     `json:"description"`
+		MetaCategory string     `json:"meta-category"`
+		Version      FlexInt    `json:"version"`
+		Active       FlexBool   `json:"active"`
+		Requirements struct {
+			Required      []string `json:"required"`
+			RequiredOneOf []string `json:"requiredOneOf"`
+		} `json:"requirements"`
+	} `json:"ObjectTemplate"`
+	ObjectTemplateElement []struct {
+		ObjectRelation     string   `json:"object_relation"`
+		Type               string   `json:"type"`
+		UIPriority         FlexInt  `json:"ui-priority"`
+		Categories         []string `json:"categories"`
+		SaneDefault        []string `json:"sane_default"`
+		ValuesList         []string `json:"values_list"`
+		Description        string   `json:"description"`
+		DisableCorrelation FlexBool `json:"disable_correlation"`
+		Multiple           FlexBool `json:"multiple"`
+	} `json:"ObjectTemplateElement"`
+}
+
+// LoadFromServer registers the active object templates known to the MISP
+// instance (/objectTemplates/index). When names are given only those
+// templates are fetched.
+func (r *TemplateRegistry) LoadFromServer(ctx context.Context, client *Client, names ...string) error {
+	var index []serverTemplate
+
+	res, err := client.GetContext(ctx, "/objectTemplates/index", nil)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if err = json.NewDecoder(res.Body).Decode(&index); err != nil {
+		return fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	wanted := make(map[string]bool, len(names))
+	for _, name := range names {
+		wanted[name] = true
+	}
+
+	for _, item := range index {
+		if !item.ObjectTemplate.Active {
+			continue
+		}
+		if len(wanted) > 0 && !wanted[item.ObjectTemplate.Name] {
+			continue
+		}
+		t, err := client.getObjectTemplate(ctx, string(item.ObjectTemplate.ID))
+		if err != nil {
+			return err
+		}
+		r.Add(t)
+	}
+	return nil
+}
+
+// getObjectTemplate fetches a template and its elements
+func (client *Client) getObjectTemplate(ctx context.Context, id string) (ObjectTemplate, error) {
+	var st serverTemplate
+
+	res, err := client.GetContext(ctx, "/objectTemplates/view/"+id, nil)
+	if err != nil {
+		return ObjectTemplate{}, err
+	}
+	defer res.Body.Close()
+	if err = json.NewDecoder(res.Body).Decode(&st); err != nil {
+		return ObjectTemplate{}, fmt.Errorf("Could not unmarshal response: %s", err)
+	}
+
+	t := ObjectTemplate{
+		UUID:          st.ObjectTemplate.UUID,
+		Name:          st.ObjectTemplate.Name,
+		Description:   st.ObjectTemplate.Description,
+		MetaCategory:  st.ObjectTemplate.MetaCategory,
+		Version:       int(st.ObjectTemplate.Version),
+		Required:      st.ObjectTemplate.Requirements.Required,
+		RequiredOneOf: st.ObjectTemplate.Requirements.RequiredOneOf,
+		Attributes:    make(map[string]ObjectTemplateAttribute, len(st.ObjectTemplateElement)),
+	}
+	for _, e := range st.ObjectTemplateElement {
+		t.Attributes[e.ObjectRelation] = ObjectTemplateAttribute{
+			MISPAttribute:      e.Type,
+			Description:        e.Description,
+			UIPriority:         int(e.UIPriority),
+			Multiple:           bool(e.Multiple),
+			DisableCorrelation: bool(e.DisableCorrelation),
+			Categories:         e.Categories,
+			SaneDefault:        e.SaneDefault,
+			ValuesList:         e.ValuesList,
+		}
+	}
+	return t, nil
+}
+
+// Validate checks obj against its template, looked up by TemplateUUID or
+// else Name. It returns an *ObjectValidationError listing every problem.
+func (r *TemplateRegistry) Validate(obj Object) error {
+	t, ok := r.Get(obj.TemplateUUID)
+	if !ok {
+		t, ok = r.Get(obj.Name)
+	}
+	if !ok {
+		return &ObjectValidationError{
+			Object:   obj.Name,
+			Problems: []string{"unknown object template"},
+		}
+	}
+	return t.Validate(obj)
+}
+
+// Validate checks obj against the template. It returns an
+// *ObjectValidationError listing every problem.
+func (t ObjectTemplate) Validate(obj Object) error {
+	var problems []string
+
+	count := make(map[string]int)
+	for _, attr := range obj.Attribute {
+		if attr.Deleted {
+			continue
+		}
+		relation := attr.ObjectRelation
+		count[relation]++
+
+		def, ok := t.Attributes[relation]
+		if !ok {
+			problems = append(problems, fmt.Sprintf("unknown object relation %q", relation))
+			continue
+		}
+		if attr.Type != def.MISPAttribute {
+			problems = append(problems, fmt.Sprintf("%s: type %q, want %q", relation, attr.Type, def.MISPAttribute))
+		}
+		if attr.Category != "" && len(def.Categories) > 0 && !contains(def.Categories, string(attr.Category)) {
+			problems = append(problems, fmt.Sprintf("%s: category %q not in %v", relation, attr.Category, def.Categories))
+		}
+		if len(def.ValuesList) > 0 && !contains(def.ValuesList, attr.Value) {
+			problems = append(problems, fmt.Sprintf("%s: value %q not in %v", relation, attr.Value, def.ValuesList))
+		}
+		if !def.Multiple && count[relation] == 2 {
+			problems = append(problems, fmt.Sprintf("%s: set more than once", relation))
+		}
+	}
+
+	for _, relation := range t.Required {
+		if count[relation] == 0 {
+			problems = append(problems, fmt.Sprintf("missing required %s", relation))
+		}
+	}
+	if len(t.RequiredOneOf) > 0 {
+		found := false
+		for _, relation := range t.RequiredOneOf {
+			if count[relation] > 0 {
+				found = true
+				break
+			}
+		}
+		if !found {
+			problems = append(problems, fmt.Sprintf("missing one of %s", strings.Join(t.RequiredOneOf, ", ")))
+		}
+	}
+
+	if len(problems) > 0 {
+		return &ObjectValidationError{Object: t.Name, Problems: problems}
+	}
+	return nil
+}
+
+// ObjectBuilder builds an object following its template, refusing relations
+// and values the template does not allow
+type ObjectBuilder struct {
+	template ObjectTemplate
+	object   Object
+}
+
+// NewObjectFromTemplate returns a builder for an object of the given
+// template name or UUID
+func (r *TemplateRegistry) NewObjectFromTemplate(nameOrUUID string) (*ObjectBuilder, error) {
+	t, ok := r.Get(nameOrUUID)
+	if !ok {
+		return nil, fmt.Errorf("NewObjectFromTemplate(): unknown object template %q", nameOrUUID)
+	}
+
+	obj := NewObject(t.Name, t.MetaCategory, t.UUID)
+	obj.Description = t.Description
+	if t.Version > 0 {
+		obj.TemplateVersion = FlexString(strconv.Itoa(t.Version))
+	}
+	return &ObjectBuilder{template: t, object: obj}, nil
+}
+
+// Set adds value for relation, with the type, category and flags the
+// template defines. The returned attribute can be tuned further until the
+// next call.
+func (b *ObjectBuilder) Set(relation, value string) (*Attribute, error) {
+	def, ok := b.template.Attributes[relation]
+	if !ok {
+		return nil, fmt.Errorf("Set(): %s has no object relation %q", b.template.Name, relation)
+	}
+	if len(def.ValuesList) > 0 && !contains(def.ValuesList, value) {
+		return nil, fmt.Errorf("Set(): %s: value %q not in %v", relation, value, def.ValuesList)
+	}
+	if !def.Multiple {
+		for _, attr := range b.object.Attribute {
+			if attr.ObjectRelation == relation {
+				return nil, fmt.Errorf("Set(): %s: set more than once", relation)
+			}
+		}
+	}
+
+	attr := b.object.AddAttribute(relation, def.MISPAttribute, value)
+	if len(def.Categories) > 0 {
+		attr.Category = Category(def.Categories[0])
+	}
+	attr.ToIDS = FlexBool(def.ToIDS)
+	attr.DisableCorrelation = FlexBool(def.DisableCorrelation)
+	return attr, nil
+}
+
+// Object returns the object built so far, validated against its template
+func (b *ObjectBuilder) Object() (Object, error) {
+	if err := b.template.Validate(b.object); err != nil {
+		return b.object, err
+	}
+	return b.object, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,149 @@
+package misp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// UnixTime is a timestamp MISP sends as Unix seconds, either as a string or
+// a number. The zero value stands for "0", never set.
+type UnixTime struct {
+	time.Time
+}
+
+// NewUnixTime returns t truncated to the second
+func NewUnixTime(t time.Time) UnixTime {
+	return UnixTime{time.Unix(t.Unix(), 0)}
+}
+
+func (t UnixTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte(`"0"`), nil
+	}
+	return json.Marshal(strconv.FormatInt(t.Unix(), 10))
+}
+
+func (t *UnixTime) UnmarshalJSON(data []byte) error {
+	s, err := unquoteScalar(data)
+	if err != nil {
+		return fmt.Errorf("UnixTime: %s", err)
+	}
+	if s == "" || s == "0" {
+		t.Time = time.Time{}
+		return nil
+	}
+	secs, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return fmt.Errorf("UnixTime: invalid timestamp %q", s)
+	}
+	t.Time = time.Unix(secs, 0)
+	return nil
+}
+
+// MISPDate is the day an event happened, sent as "YYYY-MM-DD"
+type MISPDate struct {
+	time.Time
+}
+
+// DateLayout is the layout of MISP dates
+const DateLayout = "2006-01-02"
+
+// NewMISPDate returns the day of t, at midnight UTC
+func NewMISPDate(t time.Time) MISPDate {
+	y, m, d := t.Date()
+	return MISPDate{time.Date(y, m, d, 0, 0, 0, 0, time.UTC)}
+}
+
+func (d MISPDate) String() string {
+	if d.IsZero() {
+		return ""
+	}
+	return d.Format(DateLayout)
+}
+
+func (d MISPDate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+func (d *MISPDate) UnmarshalJSON(data []byte) error {
+	s, err := unquoteScalar(data)
+	if err != nil {
+		return fmt.Errorf("MISPDate: %s", err)
+	}
+	if s == "" {
+		d.Time = time.Time{}
+		return nil
+	}
+	day, err := time.ParseInLocation(DateLayout, s, time.UTC)
+	if err != nil {
+		return fmt.Errorf("MISPDate: invalid date %q", s)
+	}
+	d.Time = day
+	return nil
+}
+
+// SeenTime is a first_seen/last_seen value, with a microsecond precision.
+// MISP sends it either as an ISO 8601 string or as Unix microseconds. The zero
+// value stands for null, never seen.
+type SeenTime struct {
+	time.Time
+}
+
+// SeenLayout is the layout used to send SeenTime values
+const SeenLayout = "2006-01-02T15:04:05.000000Z07:00"
+
+// NewSeenTime returns t truncated to the microsecond
+func NewSeenTime(t time.Time) SeenTime {
+	return SeenTime{t.Truncate(time.Microsecond)}
+}
+
+func (t SeenTime) MarshalJSON() ([]byte, error) {
+	if t.IsZero() {
+		return []byte("null"), nil
+	}
+	return json.Marshal(t.Format(SeenLayout))
+}
+
+func (t *SeenTime) UnmarshalJSON(data []byte) error {
+	s, err := unquoteScalar(data)
+	if err != nil {
+		return fmt.Errorf("SeenTime: %s", err)
+	}
+	if s == "" {
+		t.Time = time.Time{}
+		return nil
+	}
+	if micros, err := strconv.ParseInt(s, 10, 64); err == nil {
+		t.Time = time.Unix(0, micros*int64(time.Microsecond))
+		return nil
+	}
+	for _, layout := range []string{SeenLayout, time.RFC3339Nano, "2006-01-02T15:04:05.999999Z0700", "2006-01-02 15:04:05"} {
+		if seen, err := time.Parse(layout, s); err == nil {
+			t.Time = seen
+			return nil
+		}
+	}
+	return fmt.Errorf("SeenTime: invalid time %q", s)
+}
+
+// unquoteScalar returns the JSON string or number in data as a string, and
+// an empty string for null
+func unquoteScalar(data []byte) (string, error) {
+	data = bytes.TrimSpace(data)
+	if len(data) == 0 || bytes.Equal(data, []byte("null")) {
+		return "", nil
+	}
+	if data[0] == '"' {
+		var s string
+		err := json.Unmarshal(data, &s)
+		return s, err
+	}
+	var n json.Number
+	if err := json.Unmarshal(data, &n); err != nil {
+		return "", fmt.Errorf("unexpected %s", data)
+	}
+	return n.String(), nil
+}